@@ -706,6 +706,13 @@ module Machinery
           desc:      "Extract unmanaged files metadata without "\
                      "extracting the files."
       end
+      c.flag "unmanaged-files-path",
+        type:     String,
+        required: false,
+        desc:     "Only inspect the unmanaged files in the given directories. "\
+                  "Either provide one absolute path or a list of paths "\
+                  "separated by commas.",
+        arg_name: "PATH_LIST"
       c.switch "extract-changed-config-files",
         required:  false,
         negatable: false,
@@ -761,6 +768,12 @@ module Machinery
       if options["extract-metadata"]
         inspect_options[:extract_metadata] = true
       end
+      if options["unmanaged-files-path"]
+        inspect_options[:unmanaged_files_paths] = options["unmanaged-files-path"].split(",")
+      end
+      if options["unmanaged-files-baseline"]
+        inspect_options[:unmanaged_files_baseline] = options["unmanaged-files-baseline"]
+      end
 
       filter = FilterOptionParser.parse("inspect", options)
 
@@ -788,6 +801,12 @@ module Machinery
     command "inspect" do |c|
       supports_filtering(c)
       define_inspect_command_options(c)
+      c.flag "unmanaged-files-baseline",
+        type:     String,
+        required: false,
+        desc:     "Keep the state of the unmanaged files inspection in the given file on the "\
+                  "inspected system and only inspect the changes since then on the next run.",
+        arg_name: "PATH"
       c.flag ["remote-user", :r],
         type:          String,
         required:      false,
@@ -0,0 +1,38 @@
+# Copyright (c) 2016 SUSE LLC
+#
+# This program is free software; you can redistribute it and/or
+# modify it under the terms of version 3 of the GNU General Public License as
+# published by the Free Software Foundation.
+#
+# This program is distributed in the hope that it will be useful,
+# but WITHOUT ANY WARRANTY; without even the implied warranty of
+# MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+# GNU General Public License for more details.
+#
+# You should have received a copy of the GNU General Public License
+# along with this program; if not, contact SUSE LLC.
+#
+# To contact SUSE about this file by physical or electronic mail,
+# you may find current contact information at www.suse.com
+
+# = JsonLinesIO
+#
+# IO object which parses newline delimited JSON while it is written and passes
+# each record to the given block. This allows to process the output of a
+# command incrementally, e.g. for showing progress.
+class JsonLinesIO
+  def initialize(&block)
+    @buffer = ""
+    @block = block
+  end
+
+  def write(data)
+    @buffer << data
+    while (index = @buffer.index("\n"))
+      line = @buffer.slice!(0..index)
+      @block.call(JSON.parse(line)) unless line.strip.empty?
+    end
+    data.size
+  end
+  alias_method :<<, :write
+end
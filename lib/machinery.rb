@@ -118,6 +118,7 @@ require_relative "managed_files_database"
 require_relative "rpm_database"
 require_relative "dpkg_database"
 require_relative "tee_io"
+require_relative "json_lines_io"
 require_relative "static_html"
 require_relative "salt_states"
 
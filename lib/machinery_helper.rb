@@ -57,12 +57,32 @@ class MachineryHelper
     @system.inject_file(local_helper_path, remote_helper_path)
   end
 
-  def run_helper(scope, *options)
+  # Runs the helper and adds the found files to the scope. The helper streams
+  # the files as newline delimited JSON, so the number of files found so far is
+  # yielded while it is running. If the helper only reports the changes since
+  # its baseline, they are applied to the files of the previous inspection. The
+  # id of a saved baseline is kept in the scope.
+  def run_helper(scope, *options, previous: nil)
     error = TeeIO.new(STDERR, "sudo: a password is required\n")
-    json = @system.run_command(
-      remote_helper_path, *options, stdout: :capture, stderr: error, privileged: true
+    files = []
+    trailer = nil
+    output = JsonLinesIO.new do |record|
+      if record["trailer"]
+        trailer = record
+      else
+        files << record
+        yield files.count if block_given?
+      end
+    end
+    @system.run_command(
+      remote_helper_path, "--format=ndjson", *options, stdout: output, stderr: error,
+      privileged: true
     )
-    scope.insert(0, *JSON.parse(json)["files"])
+    raise Machinery::Errors::MachineryError, "The machinery-helper output is incomplete." unless trailer
+
+    files = merge_delta(previous, files) if trailer["delta"]
+    scope.baseline = trailer["baseline"] if trailer["baseline"]
+    scope.insert(0, *files.sort_by { |file| file["name"] })
   rescue Cheetah::ExecutionFailed => e
     if error.string.include?("password is required")
       raise Machinery::Errors::InsufficientPrivileges.new(@system.remote_user, @system.host)
@@ -91,6 +111,13 @@ class MachineryHelper
 
   private
 
+  def merge_delta(previous, changes)
+    changed = changes.each_with_object({}) { |change, names| names[change["name"]] = true }
+    files = Array(previous && previous.elements).reject { |file| changed[file.name] }.map(&:as_json)
+
+    files + changes.reject { |change| change.delete("change") == "removed" }
+  end
+
   def compatible_helper_arch(system_arch)
     if ["i586", "i386"].include?(system_arch)
       "i686"
@@ -0,0 +1,115 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+)
+
+// ApkDatabasePath is the database of installed Alpine packages. This needs to
+// be exported for the test cases
+var ApkDatabasePath = "/lib/apk/db/installed"
+
+// An apkPackage is an entry of the apk database with the directories and files
+// it owns as absolute paths.
+type apkPackage struct {
+	Name    string
+	Version string
+	Dirs    []string
+	Files   []string
+}
+
+// parseApkDatabase reads the "installed" database. Each package is a block of
+// "key:value" lines where "F:" starts a directory and the following "R:" lines
+// name the files in it.
+func parseApkDatabase(r io.Reader) ([]apkPackage, error) {
+	var packages []apkPackage
+	var pkg *apkPackage
+	dir := "/"
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 || line[1] != ':' {
+			pkg = nil
+			continue
+		}
+		if pkg == nil {
+			packages = append(packages, apkPackage{})
+			pkg = &packages[len(packages)-1]
+			dir = "/"
+		}
+
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			pkg.Name = value
+		case 'V':
+			pkg.Version = value
+		case 'F':
+			dir = path.Join("/", value)
+			pkg.Dirs = append(pkg.Dirs, dir)
+		case 'R':
+			pkg.Files = append(pkg.Files, path.Join(dir, value))
+		}
+	}
+	return packages, scanner.Err()
+}
+
+func hasApkDatabase() bool {
+	_, err := os.Stat(ApkDatabasePath)
+	return err == nil
+}
+
+func getManagedFilesApk() (map[string]string, map[string]bool, error) {
+	files := make(map[string]string)
+	dirs := make(map[string]bool)
+
+	database, err := os.Open(ApkDatabasePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer database.Close()
+
+	packages, err := parseApkDatabase(database)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pkg := range packages {
+		for _, dir := range pkg.Dirs {
+			dirs[dir] = true
+		}
+		for _, file := range pkg.Files {
+			// apk does not record the file type, symlinks are recognized on disk
+			target, _ := readLink(file)
+			files[file] = target
+		}
+	}
+
+	addImplicitlyManagedDirs(dirs, files)
+
+	return files, dirs, nil
+}
+
+var readLink = func(path string) (string, error) {
+	return os.Readlink(path)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetManagedFilesApk(t *testing.T) {
+	ApkDatabasePath = "fixtures/apk_installed"
+	readLink = func(path string) (string, error) {
+		if path == "/lib/libc.musl-x86_64.so.1" {
+			return "ld-musl-x86_64.so.1", nil
+		}
+		return "", errors.New("invalid argument")
+	}
+
+	files, dirs, err := getManagedFilesApk()
+	if err != nil {
+		t.Fatalf("getManagedFilesApk() failed: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"/lib/ld-musl-x86_64.so.1":                "",
+		"/lib/libc.musl-x86_64.so.1":              "ld-musl-x86_64.so.1",
+		"/etc/motd":                               "",
+		"/etc/profile.d/color_prompt.sh.disabled": "",
+	}
+	wantDirs := map[string]bool{
+		"/lib":           true,
+		"/dev":           true,
+		"/etc":           true,
+		"/etc/apk":       true,
+		"/etc/profile.d": true,
+		"/var":           true,
+		"/var/lib":       true,
+		"/var/lib/misc":  true,
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("getManagedFilesApk() files = '%v', want '%v'", files, wantFiles)
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("getManagedFilesApk() dirs = '%v', want '%v'", dirs, wantDirs)
+	}
+}
+
+func TestParseApkDatabase(t *testing.T) {
+	database := "P:foo\nV:1.0-r0\nF:usr/bin\nR:foo\n\nP:bar\nV:2.0-r1\nR:bar.conf\n"
+
+	packages, err := parseApkDatabase(strings.NewReader(database))
+	if err != nil {
+		t.Fatalf("parseApkDatabase() failed: %v", err)
+	}
+
+	want := []apkPackage{
+		{Name: "foo", Version: "1.0-r0", Dirs: []string{"/usr/bin"}, Files: []string{"/usr/bin/foo"}},
+		{Name: "bar", Version: "2.0-r1", Files: []string{"/bar.conf"}},
+	}
+	if !reflect.DeepEqual(packages, want) {
+		t.Errorf("parseApkDatabase() = '%v', want '%v'", packages, want)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A dirState is the state of a walked directory. A directory whose inode and
+// mtime did not change still has the same entries.
+type dirState struct {
+	Inode uint64 `json:"i"`
+	Mtime int64  `json:"m"`
+	// Managed is a digest of the names of the managed entries, it changes
+	// when packages are installed or removed
+	Managed string `json:"p,omitempty"`
+	// Tree is set for the directories of unmanaged trees, which have the
+	// stats of their direct entries
+	Tree  bool  `json:"t,omitempty"`
+	Size  int64 `json:"s,omitempty"`
+	Files int64 `json:"f,omitempty"`
+	Dirs  int64 `json:"d,omitempty"`
+}
+
+// A baseline is the result of an inspection together with the states of the
+// walked directories, so the next inspection only needs to read the
+// directories which changed
+type baseline struct {
+	Files []UnmanagedFile `json:"files"`
+	// Options are the inspection options, the baseline can't be used for an
+	// inspection with other ones
+	Options string `json:"options"`
+	// Started is the start time of the inspection in nanoseconds, it
+	// identifies the baseline
+	Started int64               `json:"started"`
+	Dirs    map[string]dirState `json:"dirs"`
+
+	// entries maps the directories to the unmanaged entries in them and
+	// subdirs maps them to the walked directories in them
+	entries map[string][]string
+	subdirs map[string][]string
+}
+
+// parentDir returns the directory containing path with a trailing "/" like
+// the directories of the walker
+func parentDir(path string) string {
+	parent := filepath.Dir(strings.TrimSuffix(path, "/"))
+	if parent == "/" {
+		return parent
+	}
+	return parent + "/"
+}
+
+// readBaseline reads a baseline which was saved by an inspection with the
+// given options. If id is not 0 the baseline has to have this id, so the
+// changes are not applied to the result of another inspection.
+func readBaseline(path string, options string, id int64) (*baseline, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &baseline{}
+	if err := json.Unmarshal(content, b); err != nil {
+		return nil, err
+	}
+	if b.Options != options {
+		return nil, fmt.Errorf("it was saved with the options '%s'", b.Options)
+	}
+	if id != 0 && b.Started != id {
+		return nil, fmt.Errorf("it has the id %d instead of %d", b.Started, id)
+	}
+	b.index()
+	return b, nil
+}
+
+// index maps the directories to the entries and walked directories in them
+func (b *baseline) index() {
+	b.entries = make(map[string][]string)
+	for _, entry := range b.Files {
+		name := strings.TrimSuffix(entry.Name, "/")
+		b.entries[parentDir(name)] = append(b.entries[parentDir(name)], name)
+	}
+	b.subdirs = make(map[string][]string)
+	for dir, state := range b.Dirs {
+		if state.Tree && dir != "/" {
+			b.subdirs[parentDir(dir)] = append(b.subdirs[parentDir(dir)], dir)
+		}
+	}
+}
+
+// unchanged returns the state of dir in the baseline if dir did not change
+// since. Directories which changed while the baseline was taken or shortly
+// before could have changed again within the resolution of the mtime.
+func (b *baseline) unchanged(dir string, state dirState) (dirState, bool) {
+	if b == nil {
+		return dirState{}, false
+	}
+	previous, ok := b.Dirs[dir]
+	if !ok || previous.Inode != state.Inode || previous.Mtime != state.Mtime ||
+		previous.Managed != state.Managed || previous.Tree != state.Tree {
+		return dirState{}, false
+	}
+	return previous, previous.Mtime < b.Started-int64(time.Second)
+}
+
+// save writes the baseline atomically to the file which was
+// reserved by prepareBaselineFile
+func (b *baseline) save(file *baselineFile) error {
+	defer file.dir.Close()
+
+	if err := json.NewEncoder(file.temp).Encode(b); err != nil {
+		file.temp.Close()
+		return err
+	}
+	if err := file.temp.Close(); err != nil {
+		return err
+	}
+	// the names are relative to the directory, so this works after
+	// entering a sysroot as well
+	return syscall.Renameat(int(file.dir.Fd()), filepath.Base(file.temp.Name()),
+		int(file.dir.Fd()), file.name)
+}
+
+// A baselineFile is a temporary file next to the baseline which replaces it
+// once it is written
+type baselineFile struct {
+	dir  *os.File
+	temp *os.File
+	name string
+}
+
+// prepareBaselineFile creates the temporary file for the baseline at path
+func prepareBaselineFile(path string) (*baselineFile, error) {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		dir.Close()
+		return nil, err
+	}
+	return &baselineFile{dir: dir, temp: temp, name: filepath.Base(path)}, nil
+}
+
+// managedDigests maps the directories to a digest of the names of the
+// managed files and directories in them
+func managedDigests(managedFiles map[string]string, managedDirs map[string]bool) map[string]string {
+	names := make(map[string][]string)
+	for path := range managedFiles {
+		names[parentDir(path)] = append(names[parentDir(path)], filepath.Base(path))
+	}
+	for path := range managedDirs {
+		names[parentDir(path)] = append(names[parentDir(path)], filepath.Base(path)+"/")
+	}
+
+	digests := make(map[string]string, len(names))
+	for dir, dirNames := range names {
+		sort.Strings(dirNames)
+		sum := sha256.Sum256([]byte(strings.Join(dirNames, "\x00")))
+		digests[dir] = hex.EncodeToString(sum[:8])
+	}
+	return digests
+}
+
+// unmanagedFilesByName sorts unmanaged files by their name
+type unmanagedFilesByName []UnmanagedFile
+
+func (f unmanagedFilesByName) Len() int           { return len(f) }
+func (f unmanagedFilesByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f unmanagedFilesByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// baselineDelta returns the entries which were added, modified or removed
+// since the baseline, sorted by name. Removed entries only have the name and
+// the type.
+func baselineDelta(previous []UnmanagedFile, current []UnmanagedFile) []UnmanagedFile {
+	previousEntries := make(map[string]UnmanagedFile, len(previous))
+	for _, entry := range previous {
+		previousEntries[entry.Name] = entry
+	}
+
+	delta := []UnmanagedFile{}
+	found := make(map[string]bool, len(current))
+	for _, entry := range current {
+		found[entry.Name] = true
+		previousEntry, ok := previousEntries[entry.Name]
+		if !ok {
+			entry.Change = "added"
+			delta = append(delta, entry)
+		} else if !sameEntry(previousEntry, entry) {
+			entry.Change = "modified"
+			delta = append(delta, entry)
+		}
+	}
+	for _, entry := range previous {
+		if !found[entry.Name] {
+			delta = append(delta, UnmanagedFile{Name: entry.Name, Type: entry.Type, Change: "removed"})
+		}
+	}
+	sort.Sort(unmanagedFilesByName(delta))
+	return delta
+}
+
+func sameEntry(a UnmanagedFile, b UnmanagedFile) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return bytes.Equal(aJSON, bJSON)
+}
+
+// tracksDirs returns whether the states of the directories are needed
+func (w *unmanagedFilesWalker) tracksDirs() bool {
+	return w.Baseline != nil || w.DirStates != nil
+}
+
+// checkDir returns the state of dir and whether it is unchanged since the
+// baseline. The stats of unchanged tree directories are taken from there.
+func (w *unmanagedFilesWalker) checkDir(dir string, tree bool) (dirState, bool) {
+	f, err := lstat(dir)
+	if err != nil {
+		return dirState{}, false
+	}
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return dirState{}, false
+	}
+
+	state := dirState{Inode: uint64(stat.Ino), Mtime: f.ModTime().UnixNano(), Tree: tree}
+	if !tree {
+		w.prepareManagedIndex()
+		state.Managed = w.managedDigests[dir]
+	}
+	previous, unchanged := w.Baseline.unchanged(dir, state)
+	if unchanged {
+		state = previous
+	}
+	return state, unchanged
+}
+
+// prepareManagedIndex computes the digests of the managed entries and the
+// managed directories in each directory once
+func (w *unmanagedFilesWalker) prepareManagedIndex() {
+	w.managedIndexOnce.Do(func() {
+		w.managedDigests = managedDigests(w.ManagedFiles, w.ManagedDirs)
+		w.managedSubdirs = make(map[string][]string)
+		for path := range w.ManagedDirs {
+			w.managedSubdirs[parentDir(path)] = append(w.managedSubdirs[parentDir(path)], path)
+		}
+	})
+}
+
+// recordDir keeps the state of a walked directory for the next baseline
+func (w *unmanagedFilesWalker) recordDir(dir string, state dirState) {
+	if w.DirStates == nil || state.Inode == 0 {
+		return
+	}
+	w.mutex.Lock()
+	w.DirStates[dir] = state
+	w.mutex.Unlock()
+}
+
+// revisit visits the entries of an unchanged managed directory which can
+// show up in the result: the unmanaged ones of the baseline and the managed
+// directories
+func (w *unmanagedFilesWalker) revisit(dir string) {
+	w.prepareManagedIndex()
+	names := append([]string{}, w.Baseline.entries[dir]...)
+	names = append(names, w.managedSubdirs[dir]...)
+
+	visited := make(map[string]bool, len(names))
+	for _, name := range names {
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		if f, err := lstat(name); err == nil {
+			w.visit(name, f)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBaselineDelta(t *testing.T) {
+	size := int64(10)
+	newSize := int64(20)
+	previous := []UnmanagedFile{
+		{Name: "/etc/foo", Type: "file"},
+		{Name: "/srv/", Type: "dir", Size: &size},
+		{Name: "/tmp/removed", Type: "file", User: "root"},
+	}
+	current := []UnmanagedFile{
+		{Name: "/etc/bar", Type: "file"},
+		{Name: "/etc/foo", Type: "file"},
+		{Name: "/srv/", Type: "dir", Size: &newSize},
+	}
+
+	want := []UnmanagedFile{
+		{Name: "/etc/bar", Type: "file", Change: "added"},
+		{Name: "/srv/", Type: "dir", Size: &newSize, Change: "modified"},
+		{Name: "/tmp/removed", Type: "file", Change: "removed"},
+	}
+	if delta := baselineDelta(previous, current); !reflect.DeepEqual(delta, want) {
+		t.Errorf("baselineDelta() = '%v', want '%v'", delta, want)
+	}
+	if delta := baselineDelta(current, current); len(delta) != 0 {
+		t.Errorf("baselineDelta() without changes = '%v', want none", delta)
+	}
+}
+
+func TestManagedDigests(t *testing.T) {
+	managedDirs := map[string]bool{"/usr": true, "/usr/lib": true}
+	digests := managedDigests(map[string]string{"/usr/lib/libfoo.so": ""}, managedDirs)
+	if digests["/"] == "" || digests["/usr/"] == "" || digests["/usr/lib/"] == "" {
+		t.Fatalf("managedDigests() = '%v', want digests of /, /usr/ and /usr/lib/", digests)
+	}
+
+	changed := managedDigests(map[string]string{"/usr/lib/libfoo.so": "", "/usr/lib/libbar.so": ""}, managedDirs)
+	if changed["/usr/lib/"] == digests["/usr/lib/"] || changed["/usr/"] != digests["/usr/"] {
+		t.Errorf("managedDigests() = '%v', only /usr/lib/ should differ from '%v'", changed, digests)
+	}
+}
+
+func TestWalkWithBaseline(t *testing.T) {
+	IgnoreRules = nil
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "usr", "lib"), 0755)
+	os.MkdirAll(filepath.Join(dir, "srv", "sub"), 0755)
+	for _, file := range []string{"usr/lib/libfoo.so", "usr/lib/unmanaged.so", "srv/a", "srv/sub/b"} {
+		ioutil.WriteFile(filepath.Join(dir, file), []byte("foo\n"), 0644)
+	}
+	managedFiles := map[string]string{dir + "/usr/lib/libfoo.so": ""}
+	managedDirs := map[string]bool{dir + "/usr": true, dir + "/usr/lib": true}
+
+	var mutex sync.Mutex
+	var read []string
+	readDir = func(path string) ([]os.FileInfo, error) {
+		mutex.Lock()
+		read = append(read, path)
+		mutex.Unlock()
+		return ioutil.ReadDir(path)
+	}
+	defer func() { readDir = ioutil.ReadDir }()
+
+	walk := func(previous *baseline) *unmanagedFilesWalker {
+		read = nil
+		walker := newUnmanagedFilesWalker(managedFiles, managedDirs, map[string]bool{}, 2)
+		walker.WithDirStats = true
+		walker.Baseline = previous
+		walker.DirStates = make(map[string]dirState)
+		walker.Walk(dir + "/")
+		return walker
+	}
+	newBaseline := func(walker *unmanagedFilesWalker) *baseline {
+		b := &baseline{Dirs: walker.DirStates, Started: time.Now().Add(time.Hour).UnixNano()}
+		for name, fileType := range walker.UnmanagedFiles {
+			b.Files = append(b.Files, UnmanagedFile{Name: name, Type: fileType})
+		}
+		b.index()
+		return b
+	}
+
+	first := walk(nil)
+	want := map[string]string{dir + "/usr/lib/unmanaged.so": "file", dir + "/srv/": "dir"}
+	if !reflect.DeepEqual(first.UnmanagedFiles, want) {
+		t.Fatalf("Walk() = '%v', want '%v'", first.UnmanagedFiles, want)
+	}
+
+	second := walk(newBaseline(first))
+	if len(read) != 0 {
+		t.Errorf("Walk() with an unchanged baseline read '%v', want nothing", read)
+	}
+	stats, firstStats := second.DirStats[dir+"/srv/"], first.DirStats[dir+"/srv/"]
+	if !reflect.DeepEqual(second.UnmanagedFiles, want) || stats.Size != firstStats.Size ||
+		stats.Files != firstStats.Files || stats.Dirs != firstStats.Dirs {
+		t.Errorf("Walk() with a baseline = '%v', '%v', want '%v', '%v'", second.UnmanagedFiles, stats, want, firstStats)
+	}
+	if !reflect.DeepEqual(second.DirStates, first.DirStates) {
+		t.Errorf("DirStates with a baseline = '%v', want '%v'", second.DirStates, first.DirStates)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "usr/lib/new.so"), []byte{}, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "srv/sub/c"), make([]byte, 100), 0644)
+	third := walk(newBaseline(second))
+	want[dir+"/usr/lib/new.so"] = "file"
+	if !reflect.DeepEqual(third.UnmanagedFiles, want) {
+		t.Errorf("Walk() after changes = '%v', want '%v'", third.UnmanagedFiles, want)
+	}
+	if stats := third.DirStats[dir+"/srv/"]; stats.Size != 108 || stats.Files != 3 || stats.Dirs != 1 {
+		t.Errorf("DirStats after changes = '%v', want 108, 3, 1", stats)
+	}
+	wantRead := map[string]bool{dir + "/usr/lib/": true, dir + "/srv/sub/": true}
+	for _, path := range read {
+		if !wantRead[path] {
+			t.Errorf("Walk() after changes read the unchanged %v", path)
+		}
+	}
+}
+
+func TestSaveBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "baseline.json")
+	file, err := prepareBaselineFile(path)
+	if err != nil {
+		t.Fatalf("prepareBaselineFile() failed: %v", err)
+	}
+	saved := &baseline{
+		Files:   []UnmanagedFile{{Name: "/srv/", Type: "dir"}},
+		Options: "root=/",
+		Started: 42,
+		Dirs:    map[string]dirState{"/": {Inode: 2, Mtime: 42}},
+	}
+	if err := saved.save(file); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("save() should replace the temporary file, found '%v'", files)
+	}
+
+	read, err := readBaseline(path, "root=/", 42)
+	if err != nil {
+		t.Fatalf("readBaseline() failed: %v", err)
+	}
+	if !reflect.DeepEqual(read.Files, saved.Files) || !reflect.DeepEqual(read.Dirs, saved.Dirs) {
+		t.Errorf("readBaseline() = '%+v', want '%+v'", read, saved)
+	}
+	if _, err := readBaseline(path, "root=/srv", 0); err == nil {
+		t.Errorf("readBaseline() with other options should fail")
+	}
+	if _, err := readBaseline(path, "root=/", 43); err == nil {
+		t.Errorf("readBaseline() with another id should fail")
+	}
+}
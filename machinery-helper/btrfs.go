@@ -0,0 +1,172 @@
+//  Copyright (c) 2015 SUSE LLC
+//
+//  This program is free software; you can redistribute it and/or
+//  modify it under the terms of version 3 of the GNU General Public License as
+//  published by the Free Software Foundation.
+//
+//  This program is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with this program; if not, contact SUSE LLC.
+//
+//  To contact SUSE about this file by physical or electronic mail,
+//  you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// btrfsFirstFreeObjectID is the inode number of the root directory of
+	// every btrfs subvolume
+	btrfsFirstFreeObjectID = 256
+	// btrfsSubvolInfoSize is the size of struct btrfs_ioctl_get_subvol_info_args
+	btrfsSubvolInfoSize = 504
+	btrfsSubvolReadOnly = 1 << 1
+)
+
+// btrfsIocGetSubvolInfo is BTRFS_IOC_GET_SUBVOL_INFO, it does not need any
+// privileges. The ioctl number is _IOR(0x94, 60, struct
+// btrfs_ioctl_get_subvol_info_args), the position of the read bit differs
+// between the architectures.
+var btrfsIocGetSubvolInfo = func() uintptr {
+	read := uintptr(2) << 30
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc", "ppc64", "ppc64le", "sparc64":
+		read = uintptr(2) << 29
+	}
+	return read | btrfsSubvolInfoSize<<16 | 0x94<<8 | 60
+}()
+
+// nativeEndian is the byte order of the kernel structs
+var nativeEndian = func() binary.ByteOrder {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// A btrfsSubvolume describes the subvolume which contains a path
+type btrfsSubvolume struct {
+	ID       uint64
+	Name     string
+	ParentID uint64
+	ReadOnly bool
+	// Snapshot is true for subvolumes which were created as a snapshot of
+	// another subvolume, like the ones of snapper
+	Snapshot bool
+}
+
+// parseBtrfsSubvolInfo decodes struct btrfs_ioctl_get_subvol_info_args
+func parseBtrfsSubvolInfo(buffer []byte) btrfsSubvolume {
+	name := buffer[8:264]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	parentUUID := buffer[312:328]
+
+	return btrfsSubvolume{
+		ID:       nativeEndian.Uint64(buffer[0:8]),
+		Name:     string(name),
+		ParentID: nativeEndian.Uint64(buffer[264:272]),
+		ReadOnly: nativeEndian.Uint64(buffer[288:296])&btrfsSubvolReadOnly != 0,
+		Snapshot: !bytes.Equal(parentUUID, make([]byte, len(parentUUID))),
+	}
+}
+
+// btrfsSubvolumeInfo returns the subvolume containing path. It fails with
+// ENOTTY if path is not on btrfs.
+var btrfsSubvolumeInfo = func(path string) (btrfsSubvolume, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return btrfsSubvolume{}, err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, btrfsSubvolInfoSize)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), btrfsIocGetSubvolInfo,
+		uintptr(unsafe.Pointer(&buffer[0])))
+	if errno != 0 {
+		return btrfsSubvolume{}, errno
+	}
+	return parseBtrfsSubvolInfo(buffer), nil
+}
+
+// mayBeBtrfsSubvolume returns whether a directory could be the root of a
+// btrfs subvolume, only those need to be checked with the ioctl
+func mayBeBtrfsSubvolume(f os.FileInfo) bool {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	return ok && f.IsDir() && uint64(stat.Ino) == btrfsFirstFreeObjectID
+}
+
+// skipsSubvolume returns whether the directory is a btrfs snapshot which is
+// not walked. Subvolume roots are recorded for subvolumeOf.
+func (w *unmanagedFilesWalker) skipsSubvolume(dir string, f os.FileInfo) bool {
+	if !mayBeBtrfsSubvolume(f) {
+		return false
+	}
+	subvolume, err := btrfsSubvolumeInfo(dir)
+	if err != nil {
+		return false
+	}
+	// mounted snapshots like the booted one of a snapper rollback are part
+	// of the system
+	if _, mounted := w.BtrfsMounts[dir]; subvolume.Snapshot && !w.IncludeSnapshots && !mounted {
+		return true
+	}
+
+	w.mutex.Lock()
+	if w.subvolumes == nil {
+		w.subvolumes = make(map[string]bool)
+	}
+	w.subvolumes[dir] = true
+	w.mutex.Unlock()
+	return false
+}
+
+// findSubvolumes records the subvolume roots among path and its parents,
+// which is needed when a walk does not start at "/"
+func (w *unmanagedFilesWalker) findSubvolumes(path string) {
+	for {
+		if f, err := os.Lstat(path); err == nil {
+			w.skipsSubvolume(path, f)
+		}
+		if path == "/" {
+			return
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// subvolumeOf returns the root of the btrfs subvolume containing name or an
+// empty string if it is not on btrfs
+func (w *unmanagedFilesWalker) subvolumeOf(name string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.subvolumes) == 0 {
+		return ""
+	}
+	path := filepath.Clean(name)
+	for {
+		if w.subvolumes[path] {
+			return path
+		}
+		if path == "/" {
+			return ""
+		}
+		path = filepath.Dir(path)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"github.com/nowk/go-fakefileinfo"
+	"os"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseBtrfsSubvolInfo(t *testing.T) {
+	buffer := make([]byte, btrfsSubvolInfoSize)
+	nativeEndian.PutUint64(buffer[0:], 270)
+	copy(buffer[8:], "snapshot")
+	nativeEndian.PutUint64(buffer[264:], 266)
+	nativeEndian.PutUint64(buffer[288:], btrfsSubvolReadOnly)
+	buffer[312] = 0x42
+
+	want := btrfsSubvolume{ID: 270, Name: "snapshot", ParentID: 266, ReadOnly: true, Snapshot: true}
+	if actual := parseBtrfsSubvolInfo(buffer); actual != want {
+		t.Errorf("parseBtrfsSubvolInfo() = '%+v', want '%+v'", actual, want)
+	}
+
+	buffer[312] = 0
+	nativeEndian.PutUint64(buffer[288:], 0)
+	if actual := parseBtrfsSubvolInfo(buffer); actual.Snapshot || actual.ReadOnly {
+		t.Errorf("parseBtrfsSubvolInfo() = '%+v', want a writable subvolume", actual)
+	}
+}
+
+func TestBtrfsIocGetSubvolInfo(t *testing.T) {
+	want := map[string]uintptr{"amd64": 0x81f8943c, "arm64": 0x81f8943c, "ppc64le": 0x41f8943c}
+	if expected, ok := want[runtime.GOARCH]; ok && btrfsIocGetSubvolInfo != expected {
+		t.Errorf("btrfsIocGetSubvolInfo = '%#x', want '%#x'", btrfsIocGetSubvolInfo, expected)
+	}
+}
+
+func TestUnmanagedFilesWalkerSnapshots(t *testing.T) {
+	/*
+	  We mock readDir and btrfsSubvolumeInfo with following structure:
+	   /home/                    managed, subvolume
+	   /home/foo
+	   /.snapshots/              managed, subvolume
+	   /.snapshots/1/            managed
+	   /.snapshots/1/snapshot/   snapshot
+	   /.snapshots/2/            managed
+	   /.snapshots/2/snapshot/   snapshot, mounted
+	   /srv/                     unmanaged
+	   /srv/snapshot/            snapshot
+	*/
+	subvolumeRoot := &syscall.Stat_t{Ino: btrfsFirstFreeObjectID}
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		var files []os.FileInfo
+		switch dir {
+		case "/":
+			files = append(files, fakefileinfo.New("home", int64(4096), os.ModeDir, time.Now(), true, subvolumeRoot))
+			files = append(files, fakefileinfo.New(".snapshots", int64(4096), os.ModeDir, time.Now(), true, subvolumeRoot))
+			files = append(files, fakefileinfo.New("srv", int64(4096), os.ModeDir, time.Now(), true, &syscall.Stat_t{Ino: 300}))
+		case "/home/":
+			files = append(files, fakefileinfo.New("foo", int64(10), 0, time.Now(), false, nil))
+		case "/.snapshots/":
+			files = append(files, fakefileinfo.New("1", int64(4096), os.ModeDir, time.Now(), true, nil))
+			files = append(files, fakefileinfo.New("2", int64(4096), os.ModeDir, time.Now(), true, nil))
+		case "/.snapshots/1/", "/.snapshots/2/", "/srv/":
+			files = append(files, fakefileinfo.New("snapshot", int64(4096), os.ModeDir, time.Now(), true, subvolumeRoot))
+		case "/.snapshots/2/snapshot/":
+			files = append(files, fakefileinfo.New("bar", int64(10), 0, time.Now(), false, nil))
+		default:
+			t.Errorf("directory %v should not be walked", dir)
+		}
+		return files, nil
+	}
+	defer func(original func(string) (btrfsSubvolume, error)) { btrfsSubvolumeInfo = original }(btrfsSubvolumeInfo)
+	btrfsSubvolumeInfo = func(path string) (btrfsSubvolume, error) {
+		switch path {
+		case "/home", "/.snapshots":
+			return btrfsSubvolume{Name: path[1:]}, nil
+		case "/.snapshots/1/snapshot", "/.snapshots/2/snapshot", "/srv/snapshot":
+			return btrfsSubvolume{Name: "snapshot", Snapshot: true}, nil
+		}
+		return btrfsSubvolume{}, syscall.ENOTTY
+	}
+
+	managedDirs := map[string]bool{"/home": true, "/.snapshots": true, "/.snapshots/1": true, "/.snapshots/2": true}
+	walker := newUnmanagedFilesWalker(map[string]string{}, managedDirs, map[string]bool{}, 2)
+	walker.WithDirStats = true
+	walker.BtrfsMounts = map[string]string{"/home": "/@/home", "/.snapshots/2/snapshot": "/@/.snapshots/2/snapshot"}
+	walker.Walk("/")
+
+	want := map[string]string{
+		"/home/foo":               "file",
+		"/.snapshots/2/snapshot/": "dir",
+		"/srv/":                   "dir",
+	}
+	if !reflect.DeepEqual(walker.UnmanagedFiles, want) {
+		t.Errorf("Walk() = '%v', want '%v'", walker.UnmanagedFiles, want)
+	}
+	if stats := walker.DirStats["/srv/"]; stats == nil || stats.Dirs != 1 {
+		t.Errorf("DirStats['/srv/'] = '%v', want the snapshot counted but not walked", stats)
+	}
+
+	subvolumes := map[string]string{
+		"/home/foo":               "/home",
+		"/.snapshots/2/snapshot/": "/.snapshots/2/snapshot",
+		"/.snapshots/1/":          "/.snapshots",
+		"/srv/":                   "",
+	}
+	for name, want := range subvolumes {
+		if actual := walker.subvolumeOf(name); actual != want {
+			t.Errorf("subvolumeOf('%v') = '%v', want '%v'", name, actual, want)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// A ChangedFile represents a managed file which differs from the state
+// recorded by its package in the system description.
+type ChangedFile struct {
+	Name           string   `json:"name"`
+	PackageName    string   `json:"package_name"`
+	PackageVersion string   `json:"package_version"`
+	Status         string   `json:"status"`
+	Changes        []string `json:"changes,omitempty"`
+	ErrorMessage   string   `json:"error_message,omitempty"`
+	Mode           string   `json:"mode,omitempty"`
+	User           string   `json:"user,omitempty"`
+	Group          string   `json:"group,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	Target         *string  `json:"target,omitempty"`
+}
+
+// changedFilesByName sorts the changed files by their name
+type changedFilesByName []ChangedFile
+
+func (f changedFilesByName) Len() int           { return len(f) }
+func (f changedFilesByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f changedFilesByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// attributes which are verified for a package file
+const (
+	verifySize = 1 << iota
+	verifyMode
+	verifyDigest
+	verifyLinkTarget
+	verifyUser
+	verifyGroup
+	verifyMtime
+)
+
+// A packageFile is the state of a file as it was installed by its package.
+// Checks selects the attributes which are known and compared to the file on
+// disk.
+type packageFile struct {
+	Name           string
+	PackageName    string
+	PackageVersion string
+	Config         bool
+	MissingOk      bool
+	Checks         int
+	Mode           uint32
+	Size           int64
+	User           string
+	Group          string
+	Mtime          int64
+	Digest         string
+	NewHash        func() hash.Hash
+	LinkTarget     string
+}
+
+// A changedFilesVerifier is implemented by the package managers which record
+// enough metadata about the installed files to verify them.
+type changedFilesVerifier interface {
+	PackageFiles() ([]packageFile, error)
+}
+
+var rpmDigestAlgorithms = map[int32]func() hash.Hash{
+	rpmDigestMD5:    md5.New,
+	rpmDigestSHA1:   sha1.New,
+	rpmDigestSHA256: sha256.New,
+	rpmDigestSHA384: sha512.New384,
+	rpmDigestSHA512: sha512.New,
+}
+
+func (rpmProvider) PackageFiles() ([]packageFile, error) {
+	packages, err := readRpmDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []packageFile
+	for _, pkg := range packages {
+		newHash := rpmDigestAlgorithms[rpmDigestMD5]
+		if pkg.DigestAlgo != 0 {
+			newHash = rpmDigestAlgorithms[pkg.DigestAlgo]
+		}
+
+		for _, file := range pkg.Files {
+			// like rpm -V skip ghost files and files which were not installed
+			if file.Flags&rpmFileGhost != 0 || file.State != rpmFileStateNormal {
+				continue
+			}
+
+			f := packageFile{
+				Name:           file.Name,
+				PackageName:    pkg.Name,
+				PackageVersion: pkg.Version,
+				Config:         file.Flags&rpmFileConfig != 0,
+				MissingOk:      file.Flags&rpmFileMissingOk != 0,
+				Mode:           uint32(file.Mode),
+				Size:           file.Size,
+				User:           file.User,
+				Group:          file.Group,
+				Mtime:          file.Mtime,
+				Digest:         file.Digest,
+				NewHash:        newHash,
+				LinkTarget:     file.LinkTarget,
+			}
+			switch file.Mode & rpmFileTypeMask {
+			case rpmFileTypeReg:
+				f.Checks = verifySize | verifyMode | verifyDigest | verifyUser | verifyGroup | verifyMtime
+				if f.Digest == "" || f.NewHash == nil {
+					f.Checks &^= verifyDigest
+				}
+			case rpmFileTypeLink:
+				f.Checks = verifyLinkTarget | verifyUser | verifyGroup
+			default:
+				f.Checks = verifyMode | verifyUser | verifyGroup
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// readDpkgMd5sums returns the md5sums of the files of a package mapped to
+// their absolute paths.
+func readDpkgMd5sums(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	md5sums := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) == 2 {
+			md5sums[path.Join("/", fields[1])] = fields[0]
+		}
+	}
+	return md5sums, scanner.Err()
+}
+
+// PackageFiles returns the files of all dpkg packages. dpkg only records the
+// md5sums of the files, so the other attributes can not be verified.
+func (dpkgProvider) PackageFiles() ([]packageFile, error) {
+	packages, err := readDpkgStatus()
+	if err != nil {
+		return nil, err
+	}
+	diversions, err := readDpkgDiversions()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []packageFile
+	for _, pkg := range packages {
+		if !pkg.hasFiles() {
+			continue
+		}
+
+		md5sums, err := readDpkgMd5sums(pkg.infoFile("md5sums"))
+		if os.IsNotExist(err) {
+			md5sums = make(map[string]string)
+		} else if err != nil {
+			return nil, err
+		}
+		for name, digest := range pkg.Conffiles {
+			md5sums[name] = digest
+		}
+
+		for name, digest := range md5sums {
+			_, config := pkg.Conffiles[name]
+			if diversion, ok := diversions[name]; ok && diversion.Package != pkg.Name {
+				name = diversion.DivertTo
+			}
+			files = append(files, packageFile{
+				Name:           name,
+				PackageName:    pkg.Name,
+				PackageVersion: pkg.Version,
+				Config:         config,
+				Checks:         verifyDigest,
+				Digest:         digest,
+				NewHash:        md5.New,
+			})
+		}
+	}
+	return files, nil
+}
+
+func fileDigest(name string, newHash func() hash.Hash) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyPackageFile compares a package file with the file on disk and returns
+// the changes or nil if the file is unchanged.
+func verifyPackageFile(f packageFile) *ChangedFile {
+	changedFile := &ChangedFile{
+		Name:           f.Name,
+		PackageName:    f.PackageName,
+		PackageVersion: f.PackageVersion,
+		Status:         "changed",
+	}
+
+	fi, err := os.Lstat(f.Name)
+	if os.IsNotExist(err) {
+		if f.MissingOk {
+			return nil
+		}
+		changedFile.Changes = []string{"deleted"}
+		return changedFile
+	}
+	if err != nil {
+		changedFile.Status = "error"
+		changedFile.ErrorMessage = err.Error()
+		return changedFile
+	}
+	stat := fi.Sys().(*syscall.Stat_t)
+
+	var changes []string
+	if f.Checks&verifySize != 0 && fi.Mode().IsRegular() && fi.Size() != f.Size {
+		changes = append(changes, "size")
+	}
+	if f.Checks&verifyMode != 0 && stat.Mode != f.Mode {
+		changes = append(changes, "mode")
+	}
+	if f.Checks&verifyDigest != 0 && fi.Mode().IsRegular() {
+		digest, err := fileDigest(f.Name, f.NewHash)
+		if err != nil {
+			changedFile.Status = "error"
+			changedFile.ErrorMessage = err.Error()
+			return changedFile
+		}
+		if digest != f.Digest {
+			changes = append(changes, "md5")
+		}
+	}
+	if f.Checks&verifyLinkTarget != 0 {
+		target, err := os.Readlink(f.Name)
+		if err != nil || target != f.LinkTarget {
+			changes = append(changes, "link_path")
+		}
+	}
+	if f.Checks&verifyUser != 0 && lookupUserName(stat.Uid) != f.User {
+		changes = append(changes, "user")
+	}
+	if f.Checks&verifyGroup != 0 && lookupGroupName(stat.Gid) != f.Group {
+		changes = append(changes, "group")
+	}
+	if f.Checks&verifyMtime != 0 && fi.Mode().IsRegular() && int64(stat.Mtim.Sec) != f.Mtime {
+		changes = append(changes, "time")
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changedFile.Changes = changes
+	changedFile.Mode = formatMode(fi.Mode())
+	changedFile.User = lookupUserName(stat.Uid)
+	changedFile.Group = lookupGroupName(stat.Gid)
+	switch {
+	case fi.IsDir():
+		changedFile.Type = "dir"
+	case fi.Mode()&os.ModeSymlink != 0:
+		changedFile.Type = "link"
+		target, _ := os.Readlink(f.Name)
+		changedFile.Target = &target
+	default:
+		changedFile.Type = "file"
+	}
+	return changedFile
+}
+
+// findChangedFiles verifies the package files and returns the changed ones
+// sorted by name. Files owned by several packages are only verified once.
+func findChangedFiles(files []packageFile, configOnly bool) []ChangedFile {
+	verified := make(map[string]bool)
+	changedFiles := []ChangedFile{}
+
+	for _, f := range files {
+		if f.Config != configOnly || verified[f.Name] {
+			continue
+		}
+		verified[f.Name] = true
+
+		if changedFile := verifyPackageFile(f); changedFile != nil {
+			changedFiles = append(changedFiles, *changedFile)
+		}
+	}
+
+	sort.Sort(changedFilesByName(changedFiles))
+	return changedFiles
+}
+
+// ChangedFiles represents the "changed-files" command for the machinery-helper
+func ChangedFiles(args []string) {
+	changedFilesCommand := flag.NewFlagSet("changed-files", flag.ExitOnError)
+	configOnlyFlag := changedFilesCommand.Bool("config-only", false,
+		"verify the config files instead of the other managed files")
+	packageManagerFlag := changedFilesCommand.String("package-manager", "",
+		"use the given package manager instead of detecting it")
+	changedFilesCommand.Parse(args)
+
+	provider, err := findManagedFilesProvider(*packageManagerFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	verifier, ok := provider.(changedFilesVerifier)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: verifying changed files is not supported for", provider.Name())
+		os.Exit(1)
+	}
+
+	files, err := verifier.PackageFiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: reading the package files failed:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(assembleJSON(findChangedFiles(files, *configOnlyFlag)))
+}
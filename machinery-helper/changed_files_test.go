@@ -0,0 +1,139 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"crypto/md5"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestFindChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte("foo\n")
+	for _, name := range []string{"unchanged", "modified", "config"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "modified"), []byte("bar baz\n"), 0644)
+	os.Chmod(filepath.Join(dir, "modified"), 0600)
+	os.Symlink("elsewhere", filepath.Join(dir, "link"))
+
+	fi, _ := os.Lstat(filepath.Join(dir, "unchanged"))
+	stat := fi.Sys().(*syscall.Stat_t)
+	user := lookupUserName(stat.Uid)
+	group := lookupGroupName(stat.Gid)
+
+	regular := func(name string) packageFile {
+		return packageFile{
+			Name:           filepath.Join(dir, name),
+			PackageName:    "foo",
+			PackageVersion: "1.0",
+			Checks:         verifySize | verifyMode | verifyDigest | verifyUser | verifyGroup | verifyMtime,
+			Mode:           0100644,
+			Size:           int64(len(content)),
+			User:           user,
+			Group:          group,
+			Mtime:          int64(stat.Mtim.Sec),
+			Digest:         "d3b07384d113edec49eaa6238ad5ff00",
+			NewHash:        md5.New,
+		}
+	}
+
+	config := regular("config")
+	config.Config = true
+	config.Digest = "00000000000000000000000000000000"
+	missingOk := regular("missing-ok")
+	missingOk.MissingOk = true
+	link := packageFile{
+		Name:        filepath.Join(dir, "link"),
+		PackageName: "foo",
+		Checks:      verifyLinkTarget | verifyUser | verifyGroup,
+		LinkTarget:  "target",
+		User:        user,
+		Group:       group,
+	}
+
+	files := []packageFile{
+		regular("unchanged"), regular("modified"), regular("deleted"), missingOk, config, link,
+	}
+
+	changedFiles := findChangedFiles(files, false)
+	if len(changedFiles) != 3 {
+		t.Fatalf("findChangedFiles() returned %d files, want 3: %v", len(changedFiles), changedFiles)
+	}
+
+	if want := []string{"deleted"}; !reflect.DeepEqual(changedFiles[0].Changes, want) {
+		t.Errorf("changes of deleted file = '%v', want '%v'", changedFiles[0].Changes, want)
+	}
+
+	if want := []string{"link_path"}; !reflect.DeepEqual(changedFiles[1].Changes, want) {
+		t.Errorf("changes of link = '%v', want '%v'", changedFiles[1].Changes, want)
+	}
+	if changedFiles[1].Type != "link" || *changedFiles[1].Target != "elsewhere" {
+		t.Errorf("link should be reported with its current target, got '%v'", changedFiles[1])
+	}
+
+	modified := changedFiles[2]
+	wantChanges := []string{"size", "mode", "md5"}
+	if len(modified.Changes) < 3 || !reflect.DeepEqual(modified.Changes[:3], wantChanges) {
+		t.Errorf("changes of modified file = '%v', want '%v'", modified.Changes, wantChanges)
+	}
+	if modified.Mode != "600" || modified.Type != "file" || modified.User != user {
+		t.Errorf("modified file should be reported with its current attributes, got '%v'", modified)
+	}
+
+	changedConfigFiles := findChangedFiles(files, true)
+	if len(changedConfigFiles) != 1 || changedConfigFiles[0].Name != config.Name {
+		t.Errorf("findChangedFiles() with configOnly = '%v', want only '%v'", changedConfigFiles, config.Name)
+	}
+}
+
+func TestDpkgPackageFiles(t *testing.T) {
+	DpkgDatabasePath = "fixtures/dpkg"
+
+	files, err := dpkgProvider{}.PackageFiles()
+	if err != nil {
+		t.Fatalf("PackageFiles() failed: %v", err)
+	}
+
+	found := make(map[string]packageFile)
+	for _, f := range files {
+		found[f.Name] = f
+	}
+
+	if f, ok := found["/etc/dash.conf"]; !ok || !f.Config || f.Digest != "8a7b1f8d8ba3b0d8dc0a3e1b9e8f6f6c" {
+		t.Errorf("PackageFiles() should contain the conffile /etc/dash.conf, got '%v'", f)
+	}
+	if f, ok := found["/bin/dash"]; !ok || f.Config || f.PackageVersion != "0.5.11+git20200708+dd9ef66-5" {
+		t.Errorf("PackageFiles() should contain /bin/dash, got '%v'", f)
+	}
+	if _, ok := found["/usr/bin/vim.tiny.orig"]; !ok {
+		t.Errorf("PackageFiles() should apply diversions")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// checksum algorithms which can be selected with --checksum
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+}
+
+func checksumAlgorithmNames() []string {
+	names := []string{"none"}
+	for name := range checksumAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// A checksummer adds content digests to unmanaged files. Digests are prefixed
+// with the name of the algorithm, e.g. "sha256:...".
+type checksummer struct {
+	algorithm string
+	newHash   func() hash.Hash
+	// trees enables the tree digests of directories
+	trees bool
+}
+
+// newChecksummer returns the checksummer for the given algorithm or nil if
+// the algorithm is "none"
+func newChecksummer(algorithm string, trees bool) (*checksummer, error) {
+	if algorithm == "none" {
+		return nil, nil
+	}
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown checksum algorithm '%s'", algorithm)
+	}
+	return &checksummer{algorithm: algorithm, newHash: newHash, trees: trees}, nil
+}
+
+// fileInfosByName sorts the entries of a directory by their name
+type fileInfosByName []os.FileInfo
+
+func (f fileInfosByName) Len() int           { return len(f) }
+func (f fileInfosByName) Less(i, j int) bool { return f[i].Name() < f[j].Name() }
+func (f fileInfosByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// treeDigest returns a Merkle-style digest of a directory tree. It hashes the
+// type, the digest and the name of every entry of the directory in order, so
+// it changes whenever content is added, removed, renamed or modified below
+// dir. Links contribute the digest of their target path, sockets, pipes and
+// devices as well as ignored directories are skipped. Ownership and modes are
+// not part of the digest.
+func (c *checksummer) treeDigest(dir string) (string, error) {
+	files, err := readDir(dir)
+	if err != nil {
+		return "", err
+	}
+	sort.Sort(fileInfosByName(files))
+
+	h := c.newHash()
+	for _, f := range files {
+		name := dir + f.Name()
+		if IgnoreRules.ignores(name, f.IsDir()) {
+			continue
+		}
+		var fileType, digest string
+		switch {
+		case f.IsDir():
+			if _, ok := IgnoreList[name]; ok {
+				continue
+			}
+			fileType = "dir"
+			digest, err = c.treeDigest(name + "/")
+		case f.Mode()&os.ModeSymlink != 0:
+			fileType = "link"
+			var target string
+			target, err = os.Readlink(name)
+			linkHash := c.newHash()
+			io.WriteString(linkHash, target)
+			digest = hex.EncodeToString(linkHash.Sum(nil))
+		case f.Mode().IsRegular():
+			fileType = "file"
+			digest, err = fileDigest(name, c.newHash)
+		default:
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s %s\x00", fileType, digest, f.Name())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// amend adds the digest to a file entry and to a dir entry if tree digests are
+// enabled. Files which can not be read get no digest.
+func (c *checksummer) amend(entry *UnmanagedFile) {
+	var digest string
+	var err error
+	switch {
+	case entry.Type == "file":
+		digest, err = fileDigest(entry.Name, c.newHash)
+	case entry.Type == "dir" && c.trees:
+		digest, err = c.treeDigest(entry.Name)
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not compute the checksum of", entry.Name+":", err)
+		return
+	}
+	entry.Digest = c.algorithm + ":" + digest
+}
+
+// amendAll adds the digests to the entries using up to jobs goroutines
+func (c *checksummer) amendAll(entries []UnmanagedFile, jobs int) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				c.amend(&entries[index])
+			}
+		}()
+	}
+
+	for i := range entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksummer(t *testing.T) {
+	readDir = ioutil.ReadDir
+	IgnoreList = map[string]bool{}
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "tree", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "tree", "foo"), []byte("foo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "tree", "sub", "bar"), []byte("bar\n"), 0644)
+	os.Symlink("foo", filepath.Join(dir, "tree", "link"))
+
+	if _, err := newChecksummer("crc32", false); err == nil {
+		t.Errorf("newChecksummer() with an unknown algorithm should fail")
+	}
+	if c, err := newChecksummer("none", false); c != nil || err != nil {
+		t.Errorf("newChecksummer('none') = '%v', '%v', want nil", c, err)
+	}
+
+	c, _ := newChecksummer("md5", true)
+	entries := []UnmanagedFile{
+		{Name: filepath.Join(dir, "tree", "foo"), Type: "file"},
+		{Name: filepath.Join(dir, "tree", "link"), Type: "link"},
+		{Name: filepath.Join(dir, "tree") + "/", Type: "dir"},
+		{Name: filepath.Join(dir, "missing"), Type: "file"},
+	}
+	c.amendAll(entries, 2)
+
+	if want := "md5:d3b07384d113edec49eaa6238ad5ff00"; entries[0].Digest != want {
+		t.Errorf("digest of file = '%v', want '%v'", entries[0].Digest, want)
+	}
+	if entries[1].Digest != "" || entries[3].Digest != "" {
+		t.Errorf("links and missing files should not get a digest, got '%v'", entries)
+	}
+
+	treeDigest := entries[2].Digest
+	if treeDigest == "" {
+		t.Fatalf("dir should get a tree digest")
+	}
+	c.amend(&entries[2])
+	if entries[2].Digest != treeDigest {
+		t.Errorf("tree digest is not stable: '%v' != '%v'", entries[2].Digest, treeDigest)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "tree", "sub", "bar"), []byte("baz\n"), 0644)
+	c.amend(&entries[2])
+	if entries[2].Digest == treeDigest {
+		t.Errorf("tree digest should change with the content below the dir")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DpkgDatabasePath is the dpkg administrative directory. This needs to be
+// exported for the test cases
+var DpkgDatabasePath = "/var/lib/dpkg"
+
+// package states in which the files of a package are present on the system
+var dpkgStatesWithFiles = map[string]bool{
+	"installed":        true,
+	"half-installed":   true,
+	"unpacked":         true,
+	"half-configured":  true,
+	"triggers-awaited": true,
+	"triggers-pending": true,
+}
+
+// A dpkgPackage is a package entry of the dpkg status database.
+type dpkgPackage struct {
+	Name         string
+	Architecture string
+	Version      string
+	MultiArch    string
+	Status       string
+	// Conffiles maps the conffiles of the package to their md5sums
+	Conffiles map[string]string
+}
+
+// A dpkgDiversion redirects the file of all packages but Package from Path to
+// DivertTo. Local diversions have the package ":".
+type dpkgDiversion struct {
+	Path     string
+	DivertTo string
+	Package  string
+}
+
+// parseDpkgControl splits a control file like /var/lib/dpkg/status into its
+// stanzas. Continuation lines are appended to their field separated by "\n".
+func parseDpkgControl(r io.Reader) ([]map[string]string, error) {
+	var stanzas []map[string]string
+	stanza := map[string]string{}
+	field := ""
+
+	// a bufio.Reader has no line length limit, long descriptions would
+	// exceed the token size of a bufio.Scanner
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = map[string]string{}
+			}
+			field = ""
+		case line[0] == ' ' || line[0] == '\t':
+			if field != "" {
+				stanza[field] += "\n" + strings.TrimSpace(line)
+			}
+		default:
+			if index := strings.Index(line, ":"); index > 0 {
+				field = line[:index]
+				stanza[field] = strings.TrimSpace(line[index+1:])
+			} else {
+				field = ""
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas, nil
+}
+
+func readDpkgStatus() ([]dpkgPackage, error) {
+	file, err := os.Open(filepath.Join(DpkgDatabasePath, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stanzas, err := parseDpkgControl(file)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]dpkgPackage, 0, len(stanzas))
+	for _, stanza := range stanzas {
+		pkg := dpkgPackage{
+			Name:         stanza["Package"],
+			Architecture: stanza["Architecture"],
+			Version:      stanza["Version"],
+			MultiArch:    stanza["Multi-Arch"],
+			Status:       stanza["Status"],
+			Conffiles:    make(map[string]string),
+		}
+		for _, line := range strings.Split(stanza["Conffiles"], "\n") {
+			// conffiles which are no longer shipped are marked as obsolete
+			fields := strings.Fields(line)
+			if len(fields) == 2 || len(fields) > 2 && fields[2] != "obsolete" {
+				pkg.Conffiles[fields[0]] = fields[1]
+			}
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// hasFiles returns true if the files of the package are present on the system
+func (pkg *dpkgPackage) hasFiles() bool {
+	status := strings.Fields(pkg.Status)
+	return pkg.Name != "" && len(status) == 3 && dpkgStatesWithFiles[status[2]]
+}
+
+// infoFile returns the path of a file in the dpkg info database of the package.
+// Packages which are co-installable for several architectures use the
+// "pkg:arch" name.
+func (pkg *dpkgPackage) infoFile(suffix string) string {
+	if pkg.Architecture != "" {
+		path := filepath.Join(DpkgDatabasePath, "info", pkg.Name+":"+pkg.Architecture+"."+suffix)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(DpkgDatabasePath, "info", pkg.Name+"."+suffix)
+}
+
+func readDpkgList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "/") {
+			files = append(files, filepath.Clean(line))
+		}
+	}
+	return files, scanner.Err()
+}
+
+func readDpkgDiversions() (map[string]dpkgDiversion, error) {
+	diversions := make(map[string]dpkgDiversion)
+
+	file, err := os.Open(filepath.Join(DpkgDatabasePath, "diversions"))
+	if os.IsNotExist(err) {
+		return diversions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	for i := 0; i+2 < len(lines); i += 3 {
+		diversions[lines[i]] = dpkgDiversion{
+			Path:     lines[i],
+			DivertTo: lines[i+1],
+			Package:  lines[i+2],
+		}
+	}
+	return diversions, scanner.Err()
+}
+
+// getDpkgContent returns the paths of all files which are owned by installed
+// packages with diversions applied.
+func getDpkgContent() ([]string, error) {
+	packages, err := readDpkgStatus()
+	if err != nil {
+		return nil, err
+	}
+	diversions, err := readDpkgDiversions()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, pkg := range packages {
+		if !pkg.hasFiles() {
+			continue
+		}
+
+		list, err := readDpkgList(pkg.infoFile("list"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, file := range list {
+			if diversion, ok := diversions[file]; ok && diversion.Package != pkg.Name {
+				file = diversion.DivertTo
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func hasDpkgDatabase() bool {
+	_, err := os.Stat(filepath.Join(DpkgDatabasePath, "status"))
+	return err == nil
+}
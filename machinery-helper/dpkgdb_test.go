@@ -0,0 +1,99 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseDpkgControl(t *testing.T) {
+	description := strings.Repeat("x", 100*1024)
+	control := "Package: foo\nDescription: " + description + "\n more\n\n\nPackage: bar\nStatus: ok"
+
+	stanzas, err := parseDpkgControl(strings.NewReader(control))
+	if err != nil {
+		t.Fatalf("parseDpkgControl() failed: %v", err)
+	}
+	if len(stanzas) != 2 {
+		t.Fatalf("parseDpkgControl() returned %d stanzas, want 2", len(stanzas))
+	}
+	if stanzas[0]["Description"] != description+"\nmore" {
+		t.Errorf("parseDpkgControl() did not keep the long description with its continuation line")
+	}
+	if want := map[string]string{"Package": "bar", "Status": "ok"}; !reflect.DeepEqual(stanzas[1], want) {
+		t.Errorf("parseDpkgControl()[1] = '%v', want '%v'", stanzas[1], want)
+	}
+}
+
+func TestReadDpkgStatus(t *testing.T) {
+	DpkgDatabasePath = "fixtures/dpkg"
+
+	packages, err := readDpkgStatus()
+	if err != nil {
+		t.Fatalf("readDpkgStatus() failed: %v", err)
+	}
+
+	if len(packages) != 4 {
+		t.Fatalf("readDpkgStatus() returned %d packages, want 4", len(packages))
+	}
+
+	dash := packages[0]
+	if dash.Name != "dash" || dash.Architecture != "amd64" || !dash.hasFiles() {
+		t.Errorf("readDpkgStatus() parsed dash as '%v'", dash)
+	}
+	wantConffiles := map[string]string{"/etc/dash.conf": "8a7b1f8d8ba3b0d8dc0a3e1b9e8f6f6c"}
+	if !reflect.DeepEqual(dash.Conffiles, wantConffiles) {
+		t.Errorf("dash.Conffiles = '%v', want '%v'", dash.Conffiles, wantConffiles)
+	}
+
+	oldpkg := packages[3]
+	if oldpkg.hasFiles() {
+		t.Errorf("packages in config-files state should not have files")
+	}
+}
+
+func TestGetDpkgContent(t *testing.T) {
+	DpkgDatabasePath = "fixtures/dpkg"
+
+	files, err := getDpkgContent()
+	if err != nil {
+		t.Fatalf("getDpkgContent() failed: %v", err)
+	}
+	sort.Strings(files)
+
+	want := []string{
+		"/",
+		"/",
+		"/",
+		"/bin",
+		"/bin/dash",
+		"/etc",
+		"/etc/dash.conf",
+		"/usr",
+		"/usr/bin/vim.tiny.orig",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1",
+		"/usr/share/man/man1/dash.1.gz",
+		"/usr/share/vim/vim82/doc/help.txt.vim-tiny",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("getDpkgContent() = '%v', want '%v'", files, want)
+	}
+}
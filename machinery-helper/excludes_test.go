@@ -0,0 +1,41 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReadExcludeFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("# comment\n/var/lib/rpm\n\n  /home/*/.cache  \n")
+	file.Close()
+
+	patterns, err := readExcludeFile(file.Name())
+	want := []string{"/var/lib/rpm", "/home/*/.cache"}
+	if err != nil || !reflect.DeepEqual(patterns, want) {
+		t.Errorf("readExcludeFile() = '%v', '%v', want '%v'", patterns, err, want)
+	}
+}
@@ -1,28 +1,28 @@
 package main
 
 import (
-	"bytes"
-	"log"
-	"os/exec"
-	"strings"
+	"os"
+	"syscall"
 )
 
-var statFile = func(path string) string {
-	cmd := exec.Command("stat", "-c", "%U:%G", path)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+// statFile returns the owner of a file without following symlinks
+var statFile = func(path string) (uid uint32, gid uint32, err error) {
+	fi, err := os.Lstat(path)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, err
 	}
+	stat := fi.Sys().(*syscall.Stat_t)
 
-	return strings.Trim(out.String(), "\n")
+	return stat.Uid, stat.Gid, nil
 }
 
-func getFileOwnerGroup(path string) (user, group string) {
-	split := strings.Split(statFile(path), ":")
-	user = split[0]
-	group = split[1]
+// getFileOwnerGroup returns the names of the owner and the group of a file.
+// Ids without a name are returned as numbers.
+func getFileOwnerGroup(path string) (user, group string, err error) {
+	uid, gid, err := statFile(path)
+	if err != nil {
+		return "", "", err
+	}
 
-	return
+	return lookupUserName(uid), lookupGroupName(gid), nil
 }
@@ -1,21 +1,43 @@
 package main
 
 import (
+	"os"
 	"testing"
 )
 
 func TestGetFileOwnerGroup(t *testing.T) {
-	statFile = func(path string) string {
-		return "foo:bar"
+	defer func(original string) { PasswdPath = original }(PasswdPath)
+	defer func(original string) { GroupPath = original }(GroupPath)
+	defer func(original *idNameCache) { userNames = original }(userNames)
+	defer func(original *idNameCache) { groupNames = original }(groupNames)
+	defer func(original func(string) (uint32, uint32, error)) { statFile = original }(statFile)
+
+	PasswdPath = "fixtures/passwd"
+	GroupPath = "fixtures/group"
+	userNames = newIDNameCache(&PasswdPath, func(string) (string, error) { return "", os.ErrNotExist })
+	groupNames = newIDNameCache(&GroupPath, func(string) (string, error) { return "", os.ErrNotExist })
+
+	statFile = func(path string) (uint32, uint32, error) {
+		return 1000, 1001, nil
 	}
 	path := "/etc/passwd"
 
-	owner, group := getFileOwnerGroup(path)
+	owner, group, err := getFileOwnerGroup(path)
+	if err != nil {
+		t.Fatalf("getFileOwnerGroup('%v') failed: %v", path, err)
+	}
 
 	if owner != "foo" {
 		t.Errorf("GetFileOwner('%v') = '%v', want '%v'", path, owner, "foo")
 	}
 	if group != "bar" {
-		t.Errorf("GetFileOwner('%v') = '%v', want '%v'", path, owner, "bar")
+		t.Errorf("GetFileOwner('%v') = '%v', want '%v'", path, group, "bar")
+	}
+
+	statFile = func(path string) (uint32, uint32, error) {
+		return 0, 0, os.ErrNotExist
+	}
+	if _, _, err := getFileOwnerGroup(path); err == nil {
+		t.Errorf("getFileOwnerGroup() of a vanished file should fail")
 	}
 }
@@ -0,0 +1,211 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// the classes of file systems. Special and remote mounts are not inspected,
+// remote ones are reported as remote_dir.
+const (
+	localFileSystem   = "local"
+	remoteFileSystem  = "remote"
+	specialFileSystem = "special"
+)
+
+// fileSystemTypes classifies the file systems by the type in the mountinfo
+// file. FUSE file systems are listed with their subtype like "fuse.sshfs".
+var fileSystemTypes = map[string]string{
+	"ext2":     localFileSystem,
+	"ext3":     localFileSystem,
+	"ext4":     localFileSystem,
+	"reiserfs": localFileSystem,
+	"btrfs":    localFileSystem,
+	"vfat":     localFileSystem,
+	"xfs":      localFileSystem,
+	"jfs":      localFileSystem,
+	"f2fs":     localFileSystem,
+	"exfat":    localFileSystem,
+
+	"autofs":         remoteFileSystem,
+	"cifs":           remoteFileSystem,
+	"smb3":           remoteFileSystem,
+	"nfs":            remoteFileSystem,
+	"nfs4":           remoteFileSystem,
+	"ceph":           remoteFileSystem,
+	"9p":             remoteFileSystem,
+	"afs":            remoteFileSystem,
+	"glusterfs":      remoteFileSystem,
+	"fuse.glusterfs": remoteFileSystem,
+	"fuse.sshfs":     remoteFileSystem,
+	"fuse.s3fs":      remoteFileSystem,
+
+	"proc":                  specialFileSystem,
+	"sysfs":                 specialFileSystem,
+	"devtmpfs":              specialFileSystem,
+	"devpts":                specialFileSystem,
+	"tmpfs":                 specialFileSystem,
+	"ramfs":                 specialFileSystem,
+	"rpc_pipefs":            specialFileSystem,
+	"cgroup":                specialFileSystem,
+	"cgroup2":               specialFileSystem,
+	"debugfs":               specialFileSystem,
+	"tracefs":               specialFileSystem,
+	"securityfs":            specialFileSystem,
+	"selinuxfs":             specialFileSystem,
+	"pstore":                specialFileSystem,
+	"efivarfs":              specialFileSystem,
+	"bpf":                   specialFileSystem,
+	"configfs":              specialFileSystem,
+	"fusectl":               specialFileSystem,
+	"hugetlbfs":             specialFileSystem,
+	"mqueue":                specialFileSystem,
+	"binfmt_misc":           specialFileSystem,
+	"nsfs":                  specialFileSystem,
+	"overlay":               specialFileSystem,
+	"squashfs":              specialFileSystem,
+	"fuse.gvfs-fuse-daemon": specialFileSystem,
+	"fuse.gvfsd-fuse":       specialFileSystem,
+	"fuse.portal":           specialFileSystem,
+}
+
+// fileSystemMagics classifies the file systems by the f_type of statfs as
+// defined in linux/magic.h. They are used for the types which are unknown by
+// name.
+var fileSystemMagics = map[int64]string{
+	0xef53:     localFileSystem, // ext2, ext3, ext4
+	0x52654973: localFileSystem, // reiserfs
+	0x9123683e: localFileSystem, // btrfs
+	0x4d44:     localFileSystem, // vfat
+	0x58465342: localFileSystem, // xfs
+	0x3153464a: localFileSystem, // jfs
+	0xf2f52010: localFileSystem, // f2fs
+
+	0x0187:     remoteFileSystem, // autofs
+	0x6969:     remoteFileSystem, // nfs
+	0x517b:     remoteFileSystem, // smb
+	0xfe534d42: remoteFileSystem, // smb2
+	0xff534d42: remoteFileSystem, // cifs
+	0x00c36400: remoteFileSystem, // ceph
+	0x01021997: remoteFileSystem, // 9p
+	0x5346414f: remoteFileSystem, // afs
+	0x73757245: remoteFileSystem, // coda
+
+	0x9fa0:     specialFileSystem, // proc
+	0x62656572: specialFileSystem, // sysfs
+	0x01021994: specialFileSystem, // tmpfs, devtmpfs
+	0x858458f6: specialFileSystem, // ramfs
+	0x1cd1:     specialFileSystem, // devpts
+	0x67596969: specialFileSystem, // rpc_pipefs
+	0x27e0eb:   specialFileSystem, // cgroup
+	0x63677270: specialFileSystem, // cgroup2
+	0x64626720: specialFileSystem, // debugfs
+	0x74726163: specialFileSystem, // tracefs
+	0x73636673: specialFileSystem, // securityfs
+	0xf97cff8c: specialFileSystem, // selinuxfs
+	0x6165676c: specialFileSystem, // pstore
+	0xde5e81e4: specialFileSystem, // efivarfs
+	0xcafe4a11: specialFileSystem, // bpf
+	0x62656570: specialFileSystem, // configfs
+	0x65735543: specialFileSystem, // fusectl
+	0x958458f6: specialFileSystem, // hugetlbfs
+	0x19800202: specialFileSystem, // mqueue
+	0x42494e4d: specialFileSystem, // binfmt_misc
+	0x6e736673: specialFileSystem, // nsfs
+	0x794c7630: specialFileSystem, // overlay
+	0x73717368: specialFileSystem, // squashfs
+}
+
+// remoteSuperOptions are mount options which only network file systems have,
+// like the server address of nfs and cifs
+var remoteSuperOptions = []string{"addr=", "mon_addr=", "trans=tcp", "trans=rdma"}
+
+// statfsType returns the f_type of the file system mounted at path
+var statfsType = func(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	// f_type is signed on 32 bit and some 64 bit architectures, magic numbers
+	// like the one of cifs would turn negative without the cast
+	return int64(uint32(stat.Type)), nil
+}
+
+// classifyMount returns the class of the mounted file system or an empty
+// string if it is unknown. The type is looked up first, then the mount
+// options and the statfs magic number, so unknown network file systems are
+// not accessed.
+func classifyMount(mount mountInfo) string {
+	if class, ok := fileSystemTypes[mount.FSType]; ok {
+		return class
+	}
+	for _, option := range strings.Split(mount.SuperOptions, ",") {
+		for _, remoteOption := range remoteSuperOptions {
+			if strings.HasPrefix(option, remoteOption) {
+				return remoteFileSystem
+			}
+		}
+	}
+	if magic, err := statfsType(mount.MountPoint); err == nil {
+		return fileSystemMagics[magic]
+	}
+	return ""
+}
+
+// readFileSystemClasses extends the classification from a file with one
+// class and file system per line like "remote fuse.rclone". The file system
+// is either a type or a statfs magic number like 0x6969.
+func readFileSystemClasses(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected a class and a file system", path, line)
+		}
+		class, fileSystem := fields[0], fields[1]
+		if class != localFileSystem && class != remoteFileSystem && class != specialFileSystem {
+			return fmt.Errorf("%s:%d: unknown file system class '%s'", path, line, class)
+		}
+		if strings.HasPrefix(fileSystem, "0x") {
+			magic, err := strconv.ParseInt(fileSystem[2:], 16, 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid magic number '%s'", path, line, fileSystem)
+			}
+			fileSystemMagics[magic] = class
+		} else {
+			fileSystemTypes[fileSystem] = class
+		}
+	}
+	return scanner.Err()
+}
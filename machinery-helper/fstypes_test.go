@@ -0,0 +1,93 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyMount(t *testing.T) {
+	defer func(original func(string) (int64, error)) { statfsType = original }(statfsType)
+	statfsType = func(path string) (int64, error) {
+		switch path {
+		case "/mnt/tracing":
+			return 0x74726163, nil
+		case "/mnt/unknown":
+			return 0x12345678, nil
+		}
+		return 0, syscall.ENOENT
+	}
+
+	expected := map[string]struct {
+		mount mountInfo
+		class string
+	}{
+		"type":         {mountInfo{MountPoint: "/proc", FSType: "proc"}, specialFileSystem},
+		"fuse subtype": {mountInfo{MountPoint: "/mnt/ssh", FSType: "fuse.sshfs"}, remoteFileSystem},
+		"options":      {mountInfo{MountPoint: "/mnt/nfs", FSType: "newfs", SuperOptions: "rw,addr=10.0.0.1"}, remoteFileSystem},
+		"9p over tcp":  {mountInfo{MountPoint: "/mnt/9p", FSType: "9pnew", SuperOptions: "rw,trans=tcp"}, remoteFileSystem},
+		"magic":        {mountInfo{MountPoint: "/mnt/tracing", FSType: "nodev"}, specialFileSystem},
+		"unknown":      {mountInfo{MountPoint: "/mnt/unknown", FSType: "fuse.foo"}, ""},
+		"inaccessible": {mountInfo{MountPoint: "/mnt/missing", FSType: "fuse.foo"}, ""},
+	}
+	for name, test := range expected {
+		if actual := classifyMount(test.mount); actual != test.class {
+			t.Errorf("classifyMount() of %s = '%v', want '%v'", name, actual, test.class)
+		}
+	}
+}
+
+func TestReadFileSystemClasses(t *testing.T) {
+	defer func(types map[string]string, magics map[int64]string) {
+		fileSystemTypes, fileSystemMagics = types, magics
+	}(fileSystemTypes, fileSystemMagics)
+	fileSystemTypes = map[string]string{"ext4": localFileSystem}
+	fileSystemMagics = map[int64]string{}
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "classes")
+	ioutil.WriteFile(path, []byte("# extra file systems\n\nremote fuse.rclone\nspecial   0x12345678\nlocal ext4\n"), 0644)
+	if err := readFileSystemClasses(path); err != nil {
+		t.Fatalf("readFileSystemClasses() failed: %v", err)
+	}
+	if class := fileSystemTypes["fuse.rclone"]; class != remoteFileSystem {
+		t.Errorf("class of fuse.rclone = '%v', want '%v'", class, remoteFileSystem)
+	}
+	if class := fileSystemMagics[0x12345678]; class != specialFileSystem {
+		t.Errorf("class of 0x12345678 = '%v', want '%v'", class, specialFileSystem)
+	}
+
+	for _, content := range []string{"remote\n", "network nfs\n", "special 0xzz\n"} {
+		ioutil.WriteFile(path, []byte(content), 0644)
+		if err := readFileSystemClasses(path); err == nil {
+			t.Errorf("readFileSystemClasses() of '%v' should fail", content)
+		}
+	}
+	if err := readFileSystemClasses(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("readFileSystemClasses() of a missing file should fail")
+	}
+}
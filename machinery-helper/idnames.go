@@ -0,0 +1,168 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PasswdPath is the user database. This needs to be exported for the test
+// cases
+var PasswdPath = "/etc/passwd"
+
+// GroupPath is the group database. This needs to be exported for the test
+// cases
+var GroupPath = "/etc/group"
+
+// An idNameCache resolves uids or gids to names. The names are read from a
+// file in the passwd or group format on first use. Ids which are not listed
+// there are looked up through NSS, so users from LDAP or SSSD are found as
+// well. Ids without a name resolve to the number. It is safe for concurrent
+// use.
+type idNameCache struct {
+	path      *string
+	nssLookup func(id string) (string, error)
+
+	once  sync.Once
+	mutex sync.Mutex
+	names map[uint32]idName
+}
+
+type idName struct {
+	name     string
+	resolved bool
+}
+
+func newIDNameCache(path *string, nssLookup func(id string) (string, error)) *idNameCache {
+	return &idNameCache{path: path, nssLookup: nssLookup}
+}
+
+// parseIDNames reads the names and ids from a file in the passwd or group
+// format. The first entry of an id wins like with getpwuid.
+func parseIDNames(path string) (map[uint32]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	names := make(map[uint32]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		if _, ok := names[uint32(id)]; !ok {
+			names[uint32(id)] = fields[0]
+		}
+	}
+	return names, scanner.Err()
+}
+
+func (c *idNameCache) name(id uint32) string {
+	name, _ := c.lookup(id)
+	return name
+}
+
+// lookup returns the name of the id and whether it could be resolved at all.
+// Unresolved ids are returned as number.
+func (c *idNameCache) lookup(id uint32) (string, bool) {
+	c.once.Do(func() {
+		names, err := parseIDNames(*c.path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "Could not read", *c.path+":", err)
+		}
+		c.names = make(map[uint32]idName, len(names))
+		for id, name := range names {
+			c.names[id] = idName{name: name, resolved: true}
+		}
+	})
+
+	c.mutex.Lock()
+	cached, ok := c.names[id]
+	c.mutex.Unlock()
+	if ok {
+		return cached.name, cached.resolved
+	}
+
+	cached = idName{name: strconv.FormatUint(uint64(id), 10)}
+	if nssName, err := c.nssLookup(cached.name); err == nil && nssName != "" {
+		cached = idName{name: nssName, resolved: true}
+	}
+
+	c.mutex.Lock()
+	c.names[id] = cached
+	c.mutex.Unlock()
+	return cached.name, cached.resolved
+}
+
+// getentLookup returns a lookup of the names in the given NSS database. The
+// helper is built without cgo, so the NSS modules are only reachable through
+// getent.
+func getentLookup(database string) func(id string) (string, error) {
+	return func(id string) (string, error) {
+		output, err := exec.Command("getent", database, id).Output()
+		if err != nil {
+			return "", err
+		}
+		name := strings.SplitN(string(output), ":", 2)[0]
+		if name == "" {
+			return "", fmt.Errorf("no %s entry for %s", database, id)
+		}
+		return name, nil
+	}
+}
+
+var userNames = newIDNameCache(&PasswdPath, getentLookup("passwd"))
+
+var groupNames = newIDNameCache(&GroupPath, getentLookup("group"))
+
+// lookupUserName returns the name of the user with the given uid or the uid
+// itself if there is no such user
+func lookupUserName(uid uint32) string {
+	return userNames.name(uid)
+}
+
+// lookupGroupName returns the name of the group with the given gid or the gid
+// itself if there is no such group
+func lookupGroupName(gid uint32) string {
+	return groupNames.name(gid)
+}
+
+// isOrphaned returns whether the owner or the group of a file do not exist on
+// the system
+func isOrphaned(uid uint32, gid uint32) bool {
+	_, userResolved := userNames.lookup(uid)
+	_, groupResolved := groupNames.lookup(gid)
+	return !userResolved || !groupResolved
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseIDNames(t *testing.T) {
+	names, err := parseIDNames("fixtures/passwd")
+	if err != nil {
+		t.Fatalf("parseIDNames() failed: %v", err)
+	}
+
+	want := map[uint32]string{0: "root", 1: "daemon", 1000: "foo"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("parseIDNames() = '%v', want '%v'", names, want)
+	}
+}
+
+func TestIDNameCache(t *testing.T) {
+	path := "fixtures/group"
+	nssLookups := int32(0)
+	cache := newIDNameCache(&path, func(id string) (string, error) {
+		atomic.AddInt32(&nssLookups, 1)
+		if id == "5000" {
+			return "ldap-group", nil
+		}
+		return "", errors.New("unknown group")
+	})
+
+	expected := map[uint32]string{
+		100:  "users",
+		5000: "ldap-group",
+		4242: "4242",
+	}
+	for i := 0; i < 2; i++ {
+		for id, want := range expected {
+			if name := cache.name(id); name != want {
+				t.Errorf("name(%d) = '%v', want '%v'", id, name, want)
+			}
+		}
+	}
+	if _, resolved := cache.lookup(5000); !resolved {
+		t.Errorf("lookup(5000) should be resolved through NSS")
+	}
+	if name, resolved := cache.lookup(4242); resolved || name != "4242" {
+		t.Errorf("lookup(4242) = '%v', '%v', want '4242', 'false'", name, resolved)
+	}
+	if nssLookups != 2 {
+		t.Errorf("ids should be looked up through NSS once, got %d lookups", nssLookups)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id uint32) {
+			defer wg.Done()
+			cache.name(id)
+		}(uint32(6000 + i))
+	}
+	wg.Wait()
+}
+
+func TestGetentLookup(t *testing.T) {
+	if _, err := exec.LookPath("getent"); err != nil {
+		t.Skip("getent is not available")
+	}
+
+	if name, err := getentLookup("passwd")("0"); err != nil || name != "root" {
+		t.Errorf("getentLookup('passwd')('0') = '%v', '%v', want 'root'", name, err)
+	}
+	if name, err := getentLookup("group")("4294967294"); err == nil {
+		t.Errorf("getentLookup('group')('4294967294') = '%v', want an error", name)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// An ignoreRule is a gitignore-style pattern. Patterns without a "/" match
+// the name at any depth, the others match the whole path from the root. "**"
+// matches any number of directories. A trailing "/" only matches directories
+// and a leading "!" includes paths again which were ignored by an earlier
+// rule.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// IgnoreRules are the patterns of the paths which are excluded from the walk
+// in addition to IgnoreList. This needs to be exported for the test cases
+var IgnoreRules ignoreRules
+
+type ignoreRules []ignoreRule
+
+func parseIgnoreRule(pattern string) (ignoreRule, error) {
+	var rule ignoreRule
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return ignoreRule{}, err
+		}
+		rule.segments = append(rule.segments, segment)
+	}
+	return rule, nil
+}
+
+func newIgnoreRules(patterns []string) (ignoreRules, error) {
+	rules := make(ignoreRules, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule, err := parseIgnoreRule(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matchSegments matches the path segments against the pattern segments
+func matchSegments(pattern []string, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// a trailing "**" matches everything inside
+				return len(path) > 0
+			}
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// ignores returns whether the absolute path is ignored. The last matching rule
+// wins.
+func (rules ignoreRules) ignores(path string, isDir bool) bool {
+	if len(rules) == 0 {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.negate == ignored && matchSegments(rule.segments, segments) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
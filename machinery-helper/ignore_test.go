@@ -0,0 +1,69 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := newIgnoreRules([]string{
+		"/home/*/.cache",
+		"**/*.pyc",
+		"/var/log/**/*.gz",
+		"!/var/log/keep/*.gz",
+		"build/",
+		"/srv/**",
+	})
+	if err != nil {
+		t.Fatalf("newIgnoreRules() failed: %v", err)
+	}
+
+	expected := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/home/foo/.cache", true, true},
+		{"/home/.cache", true, false},
+		{"/home/foo/bar/.cache", true, false},
+		{"/foo.pyc", false, true},
+		{"/usr/lib/python/foo.pyc", false, true},
+		{"/usr/lib/python/foo.py", false, false},
+		{"/var/log/foo.gz", false, true},
+		{"/var/log/zypp/history.1.gz", false, true},
+		{"/var/log/keep/foo.gz", false, false},
+		{"/var/log/foo.log", false, false},
+		{"/usr/src/build", true, true},
+		{"/usr/src/build", false, false},
+		{"/srv", true, false},
+		{"/srv/www", true, true},
+	}
+	for _, e := range expected {
+		if actual := rules.ignores(e.path, e.isDir); actual != e.want {
+			t.Errorf("ignores('%v', %v) = '%v', want '%v'", e.path, e.isDir, actual, e.want)
+		}
+	}
+
+	if _, err := newIgnoreRules([]string{"/foo/[a"}); err == nil {
+		t.Errorf("newIgnoreRules() with an invalid pattern should fail")
+	}
+	if ignoreRules(nil).ignores("/foo", false) {
+		t.Errorf("empty rules should not ignore anything")
+	}
+}
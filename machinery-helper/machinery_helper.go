@@ -27,68 +27,55 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"syscall"
+	"time"
 )
 
 // An UnmanagedFile represents an unmanaged file in the system description.
 type UnmanagedFile struct {
-	Name       string `json:"name"`
-	User       string `json:"user,omitempty"`
-	Group      string `json:"group,omitempty"`
-	Type       string `json:"type"`
-	Mode       string `json:"mode,omitempty"`
-	Files      *int   `json:"files,omitempty"`
-	FilesValue int    `json:"-"`
-	Dirs       *int   `json:"dirs,omitempty"`
-	DirsValue  int    `json:"-"`
-	Size       *int64 `json:"size,omitempty"`
-	SizeValue  int64  `json:"-"`
+	Name       string            `json:"name"`
+	User       string            `json:"user,omitempty"`
+	Group      string            `json:"group,omitempty"`
+	Type       string            `json:"type"`
+	Mode       string            `json:"mode,omitempty"`
+	Files      *int              `json:"files,omitempty"`
+	FilesValue int               `json:"-"`
+	Dirs       *int              `json:"dirs,omitempty"`
+	DirsValue  int               `json:"-"`
+	Size       *int64            `json:"size,omitempty"`
+	SizeValue  int64             `json:"-"`
+	Digest     string            `json:"digest,omitempty"`
+	Mtime      string            `json:"mtime,omitempty"`
+	Ctime      string            `json:"ctime,omitempty"`
+	Inode      uint64            `json:"inode,omitempty"`
+	Nlink      uint64            `json:"nlink,omitempty"`
+	Dev        uint64            `json:"dev,omitempty"`
+	Xattrs     map[string][]byte `json:"xattrs,omitempty"`
+	Orphaned   bool              `json:"orphaned,omitempty"`
+	Subvolume  string            `json:"subvolume,omitempty"`
+	Mount      *RemoteMount      `json:"mount,omitempty"`
+	// Change is "added", "modified" or "removed" in the output of an
+	// inspection with a baseline
+	Change string `json:"change,omitempty"`
 }
 
-func getDpkgContent() []string {
-	cmd := exec.Command("bash", "-c", "dpkg --get-selections | grep -v deinstall | awk '{print $1}'")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var files []string
-
-	for _, pkg := range strings.Split(out.String(), "\n") {
-		cmd := exec.Command("dpkg", "-L", pkg)
-		var out1 bytes.Buffer
-		cmd.Stdout = &out1
-		cmd.Run()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		files = append(files, strings.Split(out1.String(), "\n")...)
-	}
-
-	return files
-}
-
-func getRpmContent() []string {
+func getRpmContent() ([]string, error) {
 	cmd := exec.Command("rpm", "-qlav")
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	f := func(c rune) bool {
 		return c == '\n'
 	}
 	files := strings.FieldsFunc(out.String(), f)
-	return files
+	return files, nil
 }
 
 func parseRpmLine(line string) (fileType string, fileName string, linkTarget string) {
@@ -96,7 +83,7 @@ func parseRpmLine(line string) (fileType string, fileName string, linkTarget str
 
 	index := strings.Index(line, "/")
 	if index < 0 {
-		panic(line)
+		return
 	}
 	file := line[index:]
 	fields := strings.Split(file, " -> ")
@@ -129,51 +116,84 @@ func addImplicitlyManagedDirs(dirs map[string]bool, files map[string]string) {
 	return
 }
 
-func getManagedFilesDpkg() (map[string]string, map[string]bool) {
+func getManagedFilesDpkg() (map[string]string, map[string]bool, error) {
 	files := make(map[string]string)
 	dirs := make(map[string]bool)
 
-	for _, file := range getDpkgContent() {
-		if len(file) > 0 {
-			reg := regexp.MustCompile(`/(?:$|(.+?)(?:(/.[^.]*$)|$))`)
-			segs := reg.FindAllString(file, -1)
-			if len(segs) > 0 {
-				fileInfo, err := os.Lstat(segs[0])
-
-				if err == nil {
-					if fileInfo.IsDir() {
-						dirs[segs[0]] = true
-					} else {
-						files[segs[0]] = ""
-					}
-				}
-			}
+	content, err := getDpkgContent()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, file := range content {
+		fileInfo, err := lstat(file)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case fileInfo.IsDir():
+			dirs[file] = true
+		case fileInfo.Mode()&os.ModeSymlink != 0:
+			target, _ := readLink(file)
+			files[file] = target
+		default:
+			files[file] = ""
 		}
 	}
 
-	return files, dirs
+	addImplicitlyManagedDirs(dirs, files)
+
+	return files, dirs, nil
 }
-func getManagedFilesRpm() (map[string]string, map[string]bool) {
+
+func getManagedFilesRpm() (map[string]string, map[string]bool, error) {
 	files := make(map[string]string)
 	dirs := make(map[string]bool)
 
-	for _, pkg := range getRpmContent() {
-		if pkg != "(contains no files)" {
-			fileType, fileName, linkTarget := parseRpmLine(pkg)
-			switch fileType {
-			case "-":
-				files[fileName] = ""
-			case "d":
-				dirs[fileName] = true
-			case "l":
-				files[fileName] = linkTarget
+	packages, err := readRpmDatabase()
+	if err == nil {
+		for _, pkg := range packages {
+			for _, file := range pkg.Files {
+				switch file.Mode & rpmFileTypeMask {
+				case rpmFileTypeReg:
+					files[file.Name] = ""
+				case rpmFileTypeDir:
+					dirs[file.Name] = true
+				case rpmFileTypeLink:
+					files[file.Name] = file.LinkTarget
+				}
+			}
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "Reading the rpm database failed:", err)
+		fmt.Fprintln(os.Stderr, "Falling back to 'rpm -qlav'.")
+
+		content, err := getRpmContent()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, pkg := range content {
+			if pkg != "(contains no files)" {
+				fileType, fileName, linkTarget := parseRpmLine(pkg)
+				if fileName == "" {
+					continue
+				}
+				switch fileType {
+				case "-":
+					files[fileName] = ""
+				case "d":
+					dirs[fileName] = true
+				case "l":
+					files[fileName] = linkTarget
+				}
 			}
 		}
 	}
 
 	addImplicitlyManagedDirs(dirs, files)
 
-	return files, dirs
+	return files, dirs, nil
 }
 
 func hasExecutable(name string) bool {
@@ -185,22 +205,23 @@ func hasExecutable(name string) bool {
 	return true
 }
 
-func getManagedFiles() (map[string]string, map[string]bool) {
-	files := make(map[string]string)
-	dirs := make(map[string]bool)
-
-	switch {
-	case hasExecutable("rpm"):
-		files, dirs = getManagedFilesRpm()
-	case hasExecutable("dpkg"):
-		files, dirs = getManagedFilesDpkg()
-	}
-
-	return files, dirs
+func assembleJSON(unmanagedFilesList interface{}) string {
+	jsonMap := map[string]interface{}{"extracted": false, "files": unmanagedFilesList}
+	json, _ := json.MarshalIndent(jsonMap, " ", "  ")
+	return string(json)
 }
 
-func assembleJSON(unmanagedFilesList interface{}) string {
+// assembleBaselineJSON is assembleJSON for an inspection which used or saved
+// a baseline. delta tells whether the files are the changes since the used
+// baseline and id is the id of the saved one.
+func assembleBaselineJSON(unmanagedFilesList interface{}, delta bool, id int64) string {
 	jsonMap := map[string]interface{}{"extracted": false, "files": unmanagedFilesList}
+	if delta {
+		jsonMap["delta"] = true
+	}
+	if id != 0 {
+		jsonMap["baseline"] = id
+	}
 	json, _ := json.MarshalIndent(jsonMap, " ", "  ")
 	return string(json)
 }
@@ -209,6 +230,10 @@ var readDir = func(dir string) ([]os.FileInfo, error) {
 	return ioutil.ReadDir(dir)
 }
 
+var lstat = func(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
 var dirSize = func(path string) int64 {
 	dir, err := os.Open(path)
 	if err != nil {
@@ -231,45 +256,16 @@ func hasManagedDirs(dir string, rpmDirs map[string]bool) bool {
 	return false
 }
 
-func findUnmanagedFiles(dir string, rpmFiles map[string]string, rpmDirs map[string]bool,
-	unmanagedFiles map[string]string, ignoreList map[string]bool) {
-	files, _ := readDir(dir)
-	for _, f := range files {
-		fileName := dir + f.Name()
-		if !utf8.ValidString(fileName) {
-			fmt.Fprintln(os.Stderr, fileName, "contains invalid UTF-8 characters. Skipping.")
-		} else {
-			if _, ok := ignoreList[fileName]; !ok {
-				if f.IsDir() {
-					if _, ok := rpmDirs[fileName]; ok {
-						findUnmanagedFiles(fileName+"/", rpmFiles, rpmDirs, unmanagedFiles, ignoreList)
-					} else {
-						if !hasManagedDirs(fileName, rpmDirs) {
-							unmanagedFiles[fileName+"/"] = "dir"
-						}
-					}
-				} else {
-					if _, ok := rpmFiles[fileName]; !ok {
-						if f.Mode()&
-							(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0 {
-							// Ignore sockets, named pipes and devices
-						} else if f.Mode()&os.ModeSymlink == os.ModeSymlink {
-							unmanagedFiles[fileName] = "link"
-						} else {
-							unmanagedFiles[fileName] = "file"
-						}
-					}
-				}
-			}
-		}
-	}
-}
-
 func amendMode(entry *UnmanagedFile, perm os.FileMode) {
 	if entry.Type == "link" {
 		return
 	}
 
+	entry.Mode = formatMode(perm)
+}
+
+// formatMode returns the permission bits of a file mode as octal string
+func formatMode(perm os.FileMode) string {
 	result := int64(perm.Perm())
 
 	if perm&os.ModeSticky > 0 {
@@ -281,36 +277,13 @@ func amendMode(entry *UnmanagedFile, perm os.FileMode) {
 	if perm&os.ModeSetgid > 0 {
 		result |= 02000
 	}
-	entry.Mode = strconv.FormatInt(result, 8)
+	mode := strconv.FormatInt(result, 8)
 
 	// Pad mode string to a length of three
-	for len(entry.Mode) < 3 {
-		entry.Mode = "0" + entry.Mode
+	for len(mode) < 3 {
+		mode = "0" + mode
 	}
-}
-
-func dirInfo(path string) (size int64, fileCount int, dirCount int) {
-	files, _ := readDir(path)
-
-	size = int64(0)
-	fileCount = len(files)
-	dirCount = 0
-	for _, f := range files {
-		if f.IsDir() {
-			dirCount++
-			fileCount--
-			if _, ok := IgnoreList[path+f.Name()]; !ok {
-				subSize, subFiles, subDirs := dirInfo(path + f.Name() + "/")
-				size += subSize
-				fileCount += subFiles
-				dirCount += subDirs
-			}
-		} else if f.Mode()&os.ModeSymlink != os.ModeSymlink {
-			size += f.Size()
-		}
-	}
-
-	return
+	return mode
 }
 
 func amendSize(entry *UnmanagedFile, size int64) {
@@ -319,32 +292,68 @@ func amendSize(entry *UnmanagedFile, size int64) {
 		entry.Size = &entry.SizeValue
 	} else if entry.Type == "dir" {
 		size, files, dirs := dirInfo(entry.Name)
-		entry.SizeValue = size
-		entry.Size = &entry.SizeValue
-		entry.FilesValue = files
-		entry.Files = &entry.FilesValue
-		entry.DirsValue = dirs
-		entry.Dirs = &entry.DirsValue
+		amendDirStats(entry, &dirStats{Size: size, Files: int64(files), Dirs: int64(dirs)})
 	}
 }
 
-func amendPathAttributes(entry *UnmanagedFile, fileType string) {
+func amendDirStats(entry *UnmanagedFile, stats *dirStats) {
+	entry.SizeValue = stats.Size
+	entry.Size = &entry.SizeValue
+	entry.FilesValue = int(stats.Files)
+	entry.Files = &entry.FilesValue
+	entry.DirsValue = int(stats.Dirs)
+	entry.Dirs = &entry.DirsValue
+}
+
+// amendPathAttributes adds the metadata to the entry. The stats of directories
+// are taken from the walk if they were collected there.
+func amendPathAttributes(entry *UnmanagedFile, fileType string, stats *dirStats) error {
+	fi, err := os.Lstat(entry.Name)
+	if err != nil {
+		return err
+	}
+
 	if fileType != "link" {
-		file, err := os.Open(entry.Name)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fi, err := file.Stat()
-		if err != nil {
-			log.Fatal(err)
+		amendMode(entry, fi.Mode())
+		if stats != nil {
+			amendDirStats(entry, stats)
+		} else {
+			amendSize(entry, fi.Size())
 		}
-		file.Close()
+	}
 
-		amendMode(entry, fi.Mode())
-		amendSize(entry, fi.Size())
+	amendInodeAttributes(entry, fi)
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		entry.Orphaned = isOrphaned(stat.Uid, stat.Gid)
 	}
+	xattrs, err := readXattrs(entry.Name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not read the extended attributes of", entry.Name+":", err)
+	}
+	entry.Xattrs = xattrs
 
-	entry.User, entry.Group = getFileOwnerGroup(entry.Name)
+	entry.User, entry.Group, err = getFileOwnerGroup(entry.Name)
+	return err
+}
+
+// amendInodeAttributes adds the times and the identity of the inode to the
+// entry. Links are described by their own inode.
+func amendInodeAttributes(entry *UnmanagedFile, fi os.FileInfo) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	entry.Mtime = formatTime(stat.Mtim)
+	entry.Ctime = formatTime(stat.Ctim)
+	entry.Inode = uint64(stat.Ino)
+	entry.Nlink = uint64(stat.Nlink)
+	entry.Dev = uint64(stat.Dev)
+}
+
+// formatTime returns a file time as RFC 3339 string in UTC with nanoseconds
+func formatTime(ts syscall.Timespec) string {
+	return time.Unix(int64(ts.Sec), int64(ts.Nsec)).UTC().Format(time.RFC3339Nano)
 }
 
 func printVersion() {
@@ -352,27 +361,37 @@ func printVersion() {
 	os.Exit(0)
 }
 
-func getUnmanagedFilesList(files []string, unmanagedFiles map[string]string, extractMetadataFlag *bool) []UnmanagedFile {
-	unmanagedFilesList := make([]UnmanagedFile, len(unmanagedFiles))
-	i := 0
-	for j := range files {
-		// only add accessible files
-		if _, err := os.Lstat(files[j]); isAccessible(err) {
-			entry := UnmanagedFile{}
-			entry.Name = files[j]
-			entry.Type = unmanagedFiles[files[j]]
+// newUnmanagedFile returns the entry for an unmanaged file or false if the
+// file is not accessible
+func newUnmanagedFile(name string, fileType string, stats *dirStats, extractMetadata bool) (UnmanagedFile, bool) {
+	if _, err := os.Lstat(name); !isAccessible(err) {
+		fmt.Fprintln(os.Stderr, name, "was not accessible. Skipping.")
+		return UnmanagedFile{}, false
+	}
 
-			if *extractMetadataFlag {
-				amendPathAttributes(&entry, unmanagedFiles[files[j]])
-			}
+	entry := UnmanagedFile{}
+	entry.Name = name
+	entry.Type = fileType
 
-			unmanagedFilesList[i] = entry
-			i++
-		} else {
-			fmt.Fprintln(os.Stderr, files[j], "was not accessible. Skipping.")
+	if extractMetadata {
+		if err := amendPathAttributes(&entry, fileType, stats); err != nil {
+			fmt.Fprintln(os.Stderr, name, "was not accessible. Skipping.", err)
+			return UnmanagedFile{}, false
+		}
+	}
+	return entry, true
+}
+
+func getUnmanagedFilesList(files []string, unmanagedFiles map[string]string,
+	dirStats map[string]*dirStats, extractMetadataFlag *bool) []UnmanagedFile {
+	unmanagedFilesList := make([]UnmanagedFile, 0, len(unmanagedFiles))
+	for _, file := range files {
+		// only add accessible files
+		if entry, ok := newUnmanagedFile(file, unmanagedFiles[file], dirStats[file], *extractMetadataFlag); ok {
+			unmanagedFilesList = append(unmanagedFilesList, entry)
 		}
 	}
-	return unmanagedFilesList[0:i]
+	return unmanagedFilesList
 }
 
 func isAccessible(err error) bool {
@@ -386,19 +405,96 @@ func isAccessible(err error) bool {
 // evaluating the unmanaged files in a system.
 var IgnoreList = map[string]bool{}
 
+// newIgnoreList returns the paths which are never inspected: the given files
+// and the remote and special mounts
+func newIgnoreList(files ...string) map[string]bool {
+	ignoreList := make(map[string]bool)
+	for _, file := range files {
+		ignoreList[file] = true
+	}
+	for _, mount := range RemoteMounts() {
+		ignoreList[mount] = true
+	}
+	for _, mount := range SpecialMounts() {
+		ignoreList[mount] = true
+	}
+	return ignoreList
+}
+
+// normalizeRoots cleans the inspection roots and drops the ones which are
+// inside other roots, so no tree is walked twice. No roots means "/".
+func normalizeRoots(roots []string) ([]string, error) {
+	if len(roots) == 0 {
+		return []string{"/"}, nil
+	}
+
+	cleaned := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if !filepath.IsAbs(root) {
+			return nil, fmt.Errorf("root '%s' is not an absolute path", root)
+		}
+		cleaned = append(cleaned, filepath.Clean(root))
+	}
+	sort.Strings(cleaned)
+
+	normalized := []string{}
+	for _, root := range cleaned {
+		if !isBelowRoots(root, normalized) {
+			normalized = append(normalized, root)
+		}
+	}
+	return normalized, nil
+}
+
+// isBelowRoots returns whether path is one of the roots or inside of them
+func isBelowRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || root == "/" || strings.HasPrefix(path, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func main() {
-	// check for tar extraction
+	// check for subcommands
 	if len(os.Args) >= 2 {
 		switch os.Args[1] {
 		case "tar":
 			Tar(os.Args[2:])
 			os.Exit(0)
+		case "changed-files":
+			ChangedFiles(os.Args[2:])
+			os.Exit(0)
+		case "orphans":
+			Orphans(os.Args[2:])
+			os.Exit(0)
+		case "oci-inspect":
+			OciInspect(os.Args[2:])
+			os.Exit(0)
 		}
 	}
 
 	// parse CLI arguments
 	var versionFlag = flag.Bool("version", false, "shows the version number")
 	var extractMetadataFlag = flag.Bool("extract-metadata", false, "extracts metadata without extracting files")
+	var packageManagerFlag = flag.String("package-manager", "",
+		"use the given package manager for finding managed files instead of detecting it ("+
+			strings.Join(managedFilesProviderNames(), ", ")+")")
+	var formatFlag = flag.String("format", "json",
+		"output format, 'ndjson' streams one file per line in the order they are found")
+	var checksumFlag = flag.String("checksum", "none",
+		"adds content digests to the files ("+strings.Join(checksumAlgorithmNames(), ", ")+")")
+	var checksumDirsFlag = flag.Bool("checksum-dirs", false,
+		"adds tree digests of the whole content to the directories as well")
+	flag.StringVar(&ManifestPath, "manifest", "", "file listing managed paths for the 'manifest' package manager")
+	walkOptions := addWalkFlags(flag.CommandLine)
+	var baselineFlag = flag.String("baseline", "",
+		"only reports the changes since the inspection which saved the given baseline file")
+	var saveBaselineFlag = flag.String("save-baseline", "",
+		"saves the result and the states of the directories as baseline for the next inspection")
+	var baselineIDFlag = flag.Int64("baseline-id", 0,
+		"only uses the baseline if it has the given id, which is reported by the inspection saving it")
 	flag.Parse()
 
 	// show version
@@ -406,27 +502,121 @@ func main() {
 		printVersion()
 	}
 
+	if *formatFlag != "json" && *formatFlag != "ndjson" {
+		fmt.Fprintln(os.Stderr, "Error: unknown output format", *formatFlag)
+		os.Exit(1)
+	}
+	checksums, err := newChecksummer(*checksumFlag, *checksumDirsFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if err := walkOptions.parse(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	roots := walkOptions.Roots
+
+	// the baseline is only valid for inspections of the same trees
+	baselineOptions := strings.Join([]string{
+		"sysroot=" + *walkOptions.sysroot,
+		"root=" + strings.Join(roots, ","),
+		"exclude=" + strings.Join(walkOptions.Excludes, ","),
+		"extract-metadata=" + strconv.FormatBool(*extractMetadataFlag),
+		"one-file-system=" + strconv.FormatBool(*walkOptions.oneFileSystem),
+		"include-snapshots=" + strconv.FormatBool(*walkOptions.includeSnapshots),
+		"filesystem-classes=" + *walkOptions.fileSystemClasses,
+		"checksum=" + *checksumFlag,
+		"checksum-dirs=" + strconv.FormatBool(*checksumDirsFlag),
+	}, " ")
+	var previous *baseline
+	if *baselineFlag != "" {
+		previous, err = readBaseline(*baselineFlag, baselineOptions, *baselineIDFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not use the baseline", *baselineFlag+":", err)
+			fmt.Fprintln(os.Stderr, "Inspecting all files.")
+		}
+	}
+	var baselineFile *baselineFile
+	var ignoredFiles []string
+	if *saveBaselineFlag != "" {
+		if baselineFile, err = prepareBaselineFile(*saveBaselineFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		savePath, _ := filepath.Abs(*saveBaselineFlag)
+		tempPath, _ := filepath.Abs(baselineFile.temp.Name())
+		ignoredFiles = append(ignoredFiles, savePath, tempPath)
+	}
+	if *baselineFlag != "" {
+		baselinePath, _ := filepath.Abs(*baselineFlag)
+		ignoredFiles = append(ignoredFiles, baselinePath)
+	}
+
 	// fetch unmanaged files
-	unmanagedFiles := make(map[string]string)
-	thisBinary, _ := filepath.Abs(os.Args[0])
+	if err := walkOptions.enterSystem(ignoredFiles...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
-	IgnoreList = map[string]bool{
-		thisBinary: true,
+	managedFiles, managedDirs, err := getManagedFiles(*packageManagerFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
-	for _, mount := range RemoteMounts() {
-		IgnoreList[mount] = true
+
+	walker := walkOptions.newWalker(managedFiles, managedDirs)
+	walker.WithDirStats = *extractMetadataFlag
+
+	walker.Baseline = previous
+	if baselineFile != nil {
+		walker.DirStates = make(map[string]dirState)
 	}
-	for _, mount := range SpecialMounts() {
-		IgnoreList[mount] = true
+	started := time.Now()
+
+	remoteMounts := describeRemoteMounts()
+
+	// stream the files as they are found instead of collecting them, a
+	// baseline needs all of them though
+	var writer *ndjsonWriter
+	if *formatFlag == "ndjson" && previous == nil && baselineFile == nil {
+		writer = newNdjsonWriter(os.Stdout)
+		walker.Found = func(name string, fileType string, stats *dirStats) {
+			if entry, ok := newUnmanagedFile(name, fileType, stats, *extractMetadataFlag); ok {
+				if fileType == "remote_dir" {
+					entry.Mount = remoteMounts[strings.TrimSuffix(name, "/")]
+				} else {
+					entry.Subvolume = walker.subvolumeOf(name)
+				}
+				if checksums != nil {
+					checksums.amend(&entry)
+				}
+				if err := writer.Write(entry); err != nil {
+					fmt.Fprintln(os.Stderr, "Error:", err)
+					os.Exit(1)
+				}
+			}
+		}
 	}
 
 	for _, mount := range RemoteMounts() {
-		unmanagedFiles[mount+"/"] = "remote_dir"
+		if isBelowRoots(mount, roots) {
+			walker.found(mount+"/", "remote_dir", nil)
+		}
+	}
+	for _, root := range roots {
+		walker.WalkRoot(root)
 	}
 
-	managedFiles, managedDirs := getManagedFiles()
-	findUnmanagedFiles("/", managedFiles, managedDirs, unmanagedFiles, IgnoreList)
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
+	unmanagedFiles := walker.UnmanagedFiles
 	files := make([]string, len(unmanagedFiles))
 	i := 0
 	for k := range unmanagedFiles {
@@ -435,8 +625,61 @@ func main() {
 	}
 	sort.Strings(files)
 
-	unmanagedFilesList := getUnmanagedFilesList(files, unmanagedFiles, extractMetadataFlag)
+	unmanagedFilesList := getUnmanagedFilesList(files, unmanagedFiles, walker.DirStats, extractMetadataFlag)
+	for i, entry := range unmanagedFilesList {
+		if entry.Type == "remote_dir" {
+			unmanagedFilesList[i].Mount = remoteMounts[strings.TrimSuffix(entry.Name, "/")]
+		} else {
+			unmanagedFilesList[i].Subvolume = walker.subvolumeOf(entry.Name)
+		}
+	}
+	if checksums != nil {
+		checksums.amendAll(unmanagedFilesList, *walkOptions.jobs)
+	}
+
+	if baselineFile != nil {
+		next := &baseline{
+			Files:   unmanagedFilesList,
+			Options: baselineOptions,
+			Started: started.UnixNano(),
+			Dirs:    walker.DirStates,
+		}
+		if err := next.save(baselineFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: could not save the baseline:", err)
+			os.Exit(1)
+		}
+	}
+	if previous != nil {
+		unmanagedFilesList = baselineDelta(previous.Files, unmanagedFilesList)
+	}
 
+	if *formatFlag == "ndjson" {
+		writer = newNdjsonWriter(os.Stdout)
+		writer.trailer.Delta = previous != nil
+		if baselineFile != nil {
+			writer.trailer.Baseline = started.UnixNano()
+		}
+		for _, entry := range unmanagedFilesList {
+			if err := writer.Write(entry); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if previous != nil || baselineFile != nil {
+		var id int64
+		if baselineFile != nil {
+			id = started.UnixNano()
+		}
+		fmt.Println(assembleBaselineJSON(unmanagedFilesList, previous != nil, id))
+		return
+	}
 	json := assembleJSON(unmanagedFilesList)
 	fmt.Println(json)
 }
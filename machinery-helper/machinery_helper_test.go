@@ -19,8 +19,10 @@ package main
 
 import (
 	"github.com/nowk/go-fakefileinfo"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -122,7 +124,6 @@ func TestAssembleJSON(t *testing.T) {
 }
 
 func TestRespectManagedDirsInUnmanagedDirs(t *testing.T) {
-	unmanagedFiles := make(map[string]string)
 	wantUnmanagedFiles := make(map[string]string)
 
 	/*
@@ -155,7 +156,9 @@ func TestRespectManagedDirsInUnmanagedDirs(t *testing.T) {
 		"/managed_dir/unmanaged_dir/managed_dir": true,
 	}
 
-	findUnmanagedFiles("/", rpmFiles, rpmDirs, unmanagedFiles, ignoreList)
+	walker := newUnmanagedFilesWalker(rpmFiles, rpmDirs, ignoreList, 1)
+	walker.Walk("/")
+	unmanagedFiles := walker.UnmanagedFiles
 
 	if !reflect.DeepEqual(unmanagedFiles, wantUnmanagedFiles) {
 		t.Errorf("findUnmanagedFiles() = '%v', want '%v'", unmanagedFiles, wantUnmanagedFiles)
@@ -177,6 +180,24 @@ func TestHasManagedDirs(t *testing.T) {
 
 }
 
+func TestNormalizeRoots(t *testing.T) {
+	roots, err := normalizeRoots([]string{"/srv/www/", "/etc", "/srv", "/etc/foo", "/etcetera"})
+	want := []string{"/etc", "/etcetera", "/srv"}
+	if err != nil || !reflect.DeepEqual(roots, want) {
+		t.Errorf("normalizeRoots() = '%v', '%v', want '%v'", roots, err, want)
+	}
+
+	if roots, _ := normalizeRoots(nil); !reflect.DeepEqual(roots, []string{"/"}) {
+		t.Errorf("normalizeRoots() without roots = '%v', want '[/]'", roots)
+	}
+	if roots, _ := normalizeRoots([]string{"/etc", "/"}); !reflect.DeepEqual(roots, []string{"/"}) {
+		t.Errorf("normalizeRoots() with '/' = '%v', want '[/]'", roots)
+	}
+	if _, err := normalizeRoots([]string{"etc"}); err == nil {
+		t.Errorf("normalizeRoots() with a relative path should fail")
+	}
+}
+
 func TestSubdirIsNotAccidentallyConsideredManaged(t *testing.T) {
 	rpmDirs := map[string]bool{
 		"/usr":        true,
@@ -296,3 +317,30 @@ func TestAmendSize(t *testing.T) {
 		t.Errorf("entry.Dirs = '%v', want '%v'", *entry.Dirs, wantDirs)
 	}
 }
+
+func TestAmendInodeAttributes(t *testing.T) {
+	file, err := ioutil.TempFile("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	mtime := time.Date(2016, 3, 1, 12, 30, 0, 500, time.UTC)
+	os.Chtimes(file.Name(), mtime, mtime)
+	fi, _ := os.Lstat(file.Name())
+	stat := fi.Sys().(*syscall.Stat_t)
+
+	entry := UnmanagedFile{Name: file.Name(), Type: "file"}
+	amendInodeAttributes(&entry, fi)
+
+	if want := "2016-03-01T12:30:00.0000005Z"; entry.Mtime != want {
+		t.Errorf("entry.Mtime = '%v', want '%v'", entry.Mtime, want)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry.Ctime); err != nil {
+		t.Errorf("entry.Ctime = '%v' is no RFC 3339 time", entry.Ctime)
+	}
+	if entry.Inode != uint64(stat.Ino) || entry.Nlink != 1 || entry.Dev != uint64(stat.Dev) {
+		t.Errorf("entry = '%v', want inode %v, nlink 1, dev %v", entry, stat.Ino, stat.Dev)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A ManagedFilesProvider finds the files and directories which are owned by a
+// package manager.
+//
+// ManagedFiles returns the managed files mapped to their link target (empty
+// for anything but symlinks) and the managed directories. Directories which
+// are only implicitly managed as parents of managed files are mapped to false.
+type ManagedFilesProvider interface {
+	Name() string
+	Available() bool
+	ManagedFiles() (map[string]string, map[string]bool, error)
+}
+
+// ManagedFilesProviders lists the supported package managers in the order
+// they are tried when detecting the package manager of the system.
+var ManagedFilesProviders = []ManagedFilesProvider{
+	manifestProvider{},
+	rpmProvider{},
+	dpkgProvider{},
+	apkProvider{},
+	pacmanProvider{},
+}
+
+// ManifestPath is the file read by the "manifest" package manager
+var ManifestPath = ""
+
+type rpmProvider struct{}
+
+func (rpmProvider) Name() string {
+	return "rpm"
+}
+
+func (rpmProvider) Available() bool {
+	return hasRpmDatabase() || hasExecutable("rpm")
+}
+
+func (rpmProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	return getManagedFilesRpm()
+}
+
+type dpkgProvider struct{}
+
+func (dpkgProvider) Name() string {
+	return "dpkg"
+}
+
+func (dpkgProvider) Available() bool {
+	return hasDpkgDatabase()
+}
+
+func (dpkgProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	return getManagedFilesDpkg()
+}
+
+type apkProvider struct{}
+
+func (apkProvider) Name() string {
+	return "apk"
+}
+
+func (apkProvider) Available() bool {
+	return hasApkDatabase()
+}
+
+func (apkProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	return getManagedFilesApk()
+}
+
+type pacmanProvider struct{}
+
+func (pacmanProvider) Name() string {
+	return "pacman"
+}
+
+func (pacmanProvider) Available() bool {
+	return hasPacmanDatabase()
+}
+
+func (pacmanProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	return getManagedFilesPacman()
+}
+
+// The manifestProvider reads the managed files from a flat file with one
+// absolute path per line. Directories end with a slash, symlinks are given
+// as "path -> target" and lines starting with "#" are ignored.
+type manifestProvider struct{}
+
+func (manifestProvider) Name() string {
+	return "manifest"
+}
+
+func (manifestProvider) Available() bool {
+	return ManifestPath != ""
+}
+
+func (manifestProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	if ManifestPath == "" {
+		return nil, nil, fmt.Errorf("the manifest package manager requires --manifest")
+	}
+
+	manifest, err := os.Open(ManifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer manifest.Close()
+
+	files, dirs, err := parseManifest(manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", ManifestPath, err)
+	}
+	return files, dirs, nil
+}
+
+func parseManifest(manifest io.Reader) (map[string]string, map[string]bool, error) {
+	files := make(map[string]string)
+	dirs := make(map[string]bool)
+
+	scanner := bufio.NewScanner(manifest)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			return nil, nil, fmt.Errorf("line %d: '%s' is not an absolute path", lineNumber, line)
+		}
+
+		fields := strings.SplitN(line, " -> ", 2)
+		switch {
+		case len(fields) == 2:
+			files[filepath.Clean(fields[0])] = fields[1]
+		case strings.HasSuffix(line, "/"):
+			dirs[filepath.Clean(line)] = true
+		default:
+			files[filepath.Clean(line)] = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	addImplicitlyManagedDirs(dirs, files)
+
+	return files, dirs, nil
+}
+
+func managedFilesProviderNames() []string {
+	names := make([]string, len(ManagedFilesProviders))
+	for i, provider := range ManagedFilesProviders {
+		names[i] = provider.Name()
+	}
+	return names
+}
+
+// findManagedFilesProvider returns the provider with the given name or the
+// first available one if no name is given.
+func findManagedFilesProvider(name string) (ManagedFilesProvider, error) {
+	for _, provider := range ManagedFilesProviders {
+		if name == "" && provider.Available() || name == provider.Name() {
+			return provider, nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("unknown package manager '%s', supported are: %s",
+			name, strings.Join(managedFilesProviderNames(), ", "))
+	}
+	return nil, fmt.Errorf("no supported package manager found (%s), "+
+		"use --package-manager to select one",
+		strings.Join(managedFilesProviderNames(), ", "))
+}
+
+func getManagedFiles(packageManager string) (map[string]string, map[string]bool, error) {
+	provider, err := findManagedFilesProvider(packageManager)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, dirs, err := provider.ManagedFiles()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the managed files from %s failed: %v", provider.Name(), err)
+	}
+	return files, dirs, nil
+}
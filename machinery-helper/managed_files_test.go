@@ -0,0 +1,109 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeProvider struct {
+	name      string
+	available bool
+}
+
+func (p fakeProvider) Name() string {
+	return p.name
+}
+
+func (p fakeProvider) Available() bool {
+	return p.available
+}
+
+func (p fakeProvider) ManagedFiles() (map[string]string, map[string]bool, error) {
+	return map[string]string{"/" + p.name: ""}, map[string]bool{}, nil
+}
+
+func TestFindManagedFilesProvider(t *testing.T) {
+	defaultProviders := ManagedFilesProviders
+	defer func() { ManagedFilesProviders = defaultProviders }()
+
+	ManagedFilesProviders = []ManagedFilesProvider{
+		fakeProvider{"foo", false},
+		fakeProvider{"bar", true},
+		fakeProvider{"baz", true},
+	}
+
+	provider, err := findManagedFilesProvider("")
+	if err != nil || provider.Name() != "bar" {
+		t.Errorf("findManagedFilesProvider('') = '%v', want 'bar'", provider)
+	}
+
+	provider, err = findManagedFilesProvider("foo")
+	if err != nil || provider.Name() != "foo" {
+		t.Errorf("findManagedFilesProvider('foo') = '%v', want 'foo'", provider)
+	}
+
+	if _, err = findManagedFilesProvider("qux"); err == nil {
+		t.Errorf("findManagedFilesProvider('qux') should fail for unknown package managers")
+	}
+
+	ManagedFilesProviders = []ManagedFilesProvider{fakeProvider{"foo", false}}
+	if _, _, err = getManagedFiles(""); err == nil {
+		t.Errorf("getManagedFiles() should fail if no package manager is available")
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest := `# managed by the image build
+/etc/
+/etc/motd
+/usr/lib64/libfoo.so -> libfoo.so.1
+/opt/app/bin/app
+`
+
+	files, dirs, err := parseManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("parseManifest() failed: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"/etc/motd":            "",
+		"/usr/lib64/libfoo.so": "libfoo.so.1",
+		"/opt/app/bin/app":     "",
+	}
+	wantDirs := map[string]bool{
+		"/etc":         true,
+		"/usr":         false,
+		"/usr/lib64":   false,
+		"/opt":         false,
+		"/opt/app":     false,
+		"/opt/app/bin": false,
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("parseManifest() files = '%v', want '%v'", files, wantFiles)
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("parseManifest() dirs = '%v', want '%v'", dirs, wantDirs)
+	}
+
+	if _, _, err := parseManifest(strings.NewReader("etc/motd\n")); err == nil {
+		t.Errorf("parseManifest() should reject relative paths")
+	}
+}
@@ -18,44 +18,167 @@
 package main
 
 import (
-	"io/ioutil"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
-// this specifies the path of the process mounts. This needs to be
-// exported for the test cases
-var ProcMountsPath = "/proc/mounts"
+// this specifies the path of the mount information of the process. This
+// needs to be exported for the test cases
+var ProcMountInfoPath = "/proc/self/mountinfo"
 
-var remoteFileSystems = []string{"autofs", "cifs", "nfs", "nfs4"}
-var specialFileSystems = []string{"proc", "sysfs", "devtmpfs", "tmpfs", "rpc_pipefs", "fuse.gvfs-fuse-daemon"}
-var localFileSystems = []string{"ext2", "ext3", "ext4", "reiserfs", "btrfs", "vfat", "xfs", "jfs"}
+// A mountInfo is a line of the mountinfo file as described in proc(5)
+type mountInfo struct {
+	ID         int
+	ParentID   int
+	Device     string
+	Root       string
+	MountPoint string
+	Options    string
+	// Propagation holds the optional fields like "shared:1" or "master:2"
+	Propagation  []string
+	FSType       string
+	Source       string
+	SuperOptions string
+}
 
-func parseMounts() map[string]string {
-	mount, _ := ioutil.ReadFile(ProcMountsPath)
-	mounts := make(map[string]string)
+// sysrootMounts are used instead of the process mounts when a sysroot is
+// inspected
+var sysrootMounts []mountInfo
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines and
+// backslashes in the paths of the mountinfo file
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var unescaped bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(path[i])
+	}
+	return unescaped.String()
+}
+
+func parseMountInfoLine(line string) (mountInfo, error) {
+	fields := strings.Fields(line)
+	separator := -1
+	for i, field := range fields {
+		if field == "-" && i >= 6 {
+			separator = i
+			break
+		}
+	}
+	if separator < 0 || len(fields) < separator+3 {
+		return mountInfo{}, fmt.Errorf("invalid mountinfo line '%s'", line)
+	}
 
-	lines := strings.Split(string(mount), "\n")
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return mountInfo{}, fmt.Errorf("invalid mount id in '%s'", line)
+	}
+	parentID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return mountInfo{}, fmt.Errorf("invalid parent id in '%s'", line)
+	}
 
-	for _, line := range lines {
-		elements := strings.Split(line, " ")
+	mount := mountInfo{
+		ID:          id,
+		ParentID:    parentID,
+		Device:      fields[2],
+		Root:        unescapeMountPath(fields[3]),
+		MountPoint:  unescapeMountPath(fields[4]),
+		Options:     fields[5],
+		Propagation: fields[6:separator],
+		FSType:      fields[separator+1],
+		Source:      unescapeMountPath(fields[separator+2]),
+	}
+	if len(fields) > separator+3 {
+		mount.SuperOptions = fields[separator+3]
+	}
+	return mount, nil
+}
 
-		if len(elements) >= 3 {
-			mounts[elements[1]] = elements[2]
+// parseMountInfo returns the mounts in the order they were mounted, so a
+// mount which is stacked on the same path comes after the ones it hides
+func parseMountInfo(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		mount, err := parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return nil, err
 		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, scanner.Err()
+}
+
+// readMounts returns the mounts of the process or the ones inside the
+// sysroot
+func readMounts() []mountInfo {
+	if sysrootMounts != nil {
+		return sysrootMounts
+	}
+
+	file, err := os.Open(ProcMountInfoPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not read the mounts:", err)
+		return nil
+	}
+	defer file.Close()
+
+	mounts, err := parseMountInfo(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not read the mounts:", err)
 	}
+	return mounts
+}
 
+// visibleMounts maps the mount points to the mount which is visible there,
+// which is the one mounted last
+func visibleMounts() map[string]mountInfo {
+	mounts := make(map[string]mountInfo)
+	for _, mount := range readMounts() {
+		mounts[mount.MountPoint] = mount
+	}
 	return mounts
 }
 
-func selectFileSystems(allMounts map[string]string, fileSystems []string) []string {
+// parseMounts maps the mount points to the file system which is visible
+// there
+func parseMounts() map[string]string {
+	mounts := make(map[string]string)
+	for path, mount := range visibleMounts() {
+		mounts[path] = mount.FSType
+	}
+	return mounts
+}
+
+// selectFileSystems returns the sorted mount points of the file systems of
+// the given class
+func selectFileSystems(class string) []string {
 	mounts := []string{}
 
-	for path, fs := range allMounts {
-		for _, specialFs := range fileSystems {
-			if specialFs == fs {
-				mounts = append(mounts, path)
-			}
+	for path, mount := range visibleMounts() {
+		if classifyMount(mount) == class {
+			mounts = append(mounts, path)
 		}
 	}
 	sort.Strings(mounts)
@@ -66,16 +189,57 @@ func selectFileSystems(allMounts map[string]string, fileSystems []string) []stri
 // SpecialMounts returns an array of all special mount paths like
 // proc or sysfs
 func SpecialMounts() []string {
-	return selectFileSystems(parseMounts(), specialFileSystems)
+	return selectFileSystems(specialFileSystem)
 }
 
 // LocalMounts returns an array of all local mount paths
 func LocalMounts() []string {
-	return selectFileSystems(parseMounts(), localFileSystems)
+	return selectFileSystems(localFileSystem)
+}
+
+// btrfsSubvolume returns the path of the mounted subvolume inside the btrfs
+// file system, e.g. "/@/home"
+func (m mountInfo) btrfsSubvolume() string {
+	for _, option := range strings.Split(m.SuperOptions, ",") {
+		if strings.HasPrefix(option, "subvol=") {
+			return strings.TrimPrefix(option, "subvol=")
+		}
+	}
+	return m.Root
+}
+
+// BtrfsMounts maps the mount points of btrfs subvolumes to the mounted
+// subvolume
+func BtrfsMounts() map[string]string {
+	mounts := make(map[string]string)
+	for _, mount := range readMounts() {
+		if mount.FSType == "btrfs" {
+			mounts[mount.MountPoint] = mount.btrfsSubvolume()
+		} else {
+			delete(mounts, mount.MountPoint)
+		}
+	}
+	return mounts
+}
+
+// fileSystemDevices returns the device numbers of the file systems containing
+// the paths. Paths which do not exist are left out.
+func fileSystemDevices(paths []string) map[uint64]bool {
+	devices := make(map[uint64]bool)
+	for _, path := range paths {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+			devices[uint64(stat.Dev)] = true
+		}
+	}
+	return devices
 }
 
 // RemoteMounts returns an array of all remote mount paths
 // (for example NFS mount points)
 func RemoteMounts() []string {
-	return selectFileSystems(parseMounts(), remoteFileSystems)
+	return selectFileSystems(remoteFileSystem)
 }
@@ -1,74 +1,182 @@
-// Copyright (c) 2015 SUSE LLC
+//  Copyright (c) 2015 SUSE LLC
 //
-// This program is free software; you can redistribute it and/or
-// modify it under the terms of version 3 of the GNU General Public License as
-// published by the Free Software Foundation.
+//  This program is free software; you can redistribute it and/or
+//  modify it under the terms of version 3 of the GNU General Public License as
+//  published by the Free Software Foundation.
 //
-// This program is distributed in the hope that it will be useful,
-// but WITHOUT ANY WARRANTY; without even the implied warranty of
-// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
-// GNU General Public License for more details.
+//  This program is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+//  GNU General Public License for more details.
 //
-// You should have received a copy of the GNU General Public License
-// along with this program; if not, contact SUSE LLC.
+//  You should have received a copy of the GNU General Public License
+//  along with this program; if not, contact SUSE LLC.
 //
-// To contact SUSE about this file by physical or electronic mail,
-// you may find current contact information at www.suse.com
+//  To contact SUSE about this file by physical or electronic mail,
+//  you may find current contact information at www.suse.com
 
 package main
 
 import (
+	"io/ioutil"
+	"os"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 )
 
+func TestUnescapeMountPath(t *testing.T) {
+	expected := map[string]string{
+		"/srv/my\\040share":   "/srv/my share",
+		"/tab\\011and\\012nl": "/tab\tand\nnl",
+		"/back\\134slash":     "/back\\slash",
+		"/plain":              "/plain",
+		"/not\\08escape\\":    "/not\\08escape\\",
+		"/truncated\\04":      "/truncated\\04",
+	}
+	for path, want := range expected {
+		if actual := unescapeMountPath(path); actual != want {
+			t.Errorf("unescapeMountPath('%v') = '%v', want '%v'", path, actual, want)
+		}
+	}
+}
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(
+		"22 20 0:40 / /homes/tux rw,nosuid shared:3 master:1 - nfs host:/real-home/tux rw,vers=4.2\n" +
+			"29 23 253:1 /backup\\134old /data/bind\\040dir rw - ext4 /dev/mapper/lvm-data rw\n"))
+	if err != nil {
+		t.Fatalf("parseMountInfo() failed: %v", err)
+	}
+
+	expectedMounts := []mountInfo{
+		{
+			ID:           22,
+			ParentID:     20,
+			Device:       "0:40",
+			Root:         "/",
+			MountPoint:   "/homes/tux",
+			Options:      "rw,nosuid",
+			Propagation:  []string{"shared:3", "master:1"},
+			FSType:       "nfs",
+			Source:       "host:/real-home/tux",
+			SuperOptions: "rw,vers=4.2",
+		},
+		{
+			ID:           29,
+			ParentID:     23,
+			Device:       "253:1",
+			Root:         "/backup\\old",
+			MountPoint:   "/data/bind dir",
+			Options:      "rw",
+			Propagation:  []string{},
+			FSType:       "ext4",
+			Source:       "/dev/mapper/lvm-data",
+			SuperOptions: "rw",
+		},
+	}
+	if !reflect.DeepEqual(mounts, expectedMounts) {
+		t.Errorf("parseMountInfo() = '%+v', want '%+v'", mounts, expectedMounts)
+	}
+
+	if _, err := parseMountInfo(strings.NewReader("22 20 0:40 / /homes/tux rw\n")); err == nil {
+		t.Errorf("parseMountInfo() of a line without separator should fail")
+	}
+}
+
 func TestParseMounts(t *testing.T) {
-	ProcMountsPath = "fixtures/proc_mounts"
+	ProcMountInfoPath = "fixtures/mountinfo"
 
 	expectedMounts := map[string]string{
-		"/dev":              "devtmpfs",
-		"/homes/tux":        "nfs",
-		"/data":             "ext4",
-		"/":                 "ext4",
-		"/var/lib/ntp/proc": "proc",
-		"/var/lib/tmpfs":    "tmpfs",
+		"/dev":                 "devtmpfs",
+		"/homes/tux":           "nfs",
+		"/data":                "ext4",
+		"/data/bind":           "ext4",
+		"/":                    "ext4",
+		"/var/lib/ntp/proc":    "proc",
+		"/var/lib/tmpfs":       "tmpfs",
+		"/srv/my share":        "cifs",
+		"/mnt/stacked":         "tmpfs",
+		"/home":                "btrfs",
+		"/.snapshots":          "btrfs",
+		"/srv":                 "btrfs",
+		"/sys/fs/cgroup":       "cgroup2",
+		"/mnt/sshfs":           "fuse.sshfs",
+		"/mnt/cluster":         "clusterfs",
+		"/net":                 "autofs",
+		"/net/fileserver/data": "nfs4",
 	}
 
 	actualMounts := parseMounts()
 	if !reflect.DeepEqual(actualMounts, expectedMounts) {
-		t.Errorf("Expected: ", expectedMounts, " Got: ", actualMounts)
+		t.Errorf("parseMounts() = '%v', want '%v'", actualMounts, expectedMounts)
 	}
 }
 
 func TestSpecialMounts(t *testing.T) {
-	ProcMountsPath = "fixtures/proc_mounts"
+	ProcMountInfoPath = "fixtures/mountinfo"
 
-	expectedMounts := []string{"/dev", "/var/lib/ntp/proc", "/var/lib/tmpfs"}
+	expectedMounts := []string{"/dev", "/mnt/stacked", "/sys/fs/cgroup", "/var/lib/ntp/proc", "/var/lib/tmpfs"}
 	actualMounts := SpecialMounts()
 
 	if !reflect.DeepEqual(actualMounts, expectedMounts) {
-		t.Errorf("Expected: ", expectedMounts, " Got: ", actualMounts)
+		t.Errorf("SpecialMounts() = '%v', want '%v'", actualMounts, expectedMounts)
 	}
 }
 
 func TestLocalMounts(t *testing.T) {
-	ProcMountsPath = "fixtures/proc_mounts"
+	ProcMountInfoPath = "fixtures/mountinfo"
 
-	expectedMounts := []string{"/", "/data"}
+	expectedMounts := []string{"/", "/.snapshots", "/data", "/data/bind", "/home", "/srv"}
 	actualMounts := LocalMounts()
 
 	if !reflect.DeepEqual(actualMounts, expectedMounts) {
-		t.Errorf("Expected: ", expectedMounts, " Got: ", actualMounts)
+		t.Errorf("LocalMounts() = '%v', want '%v'", actualMounts, expectedMounts)
 	}
 }
 
 func TestRemoteMounts(t *testing.T) {
-	ProcMountsPath = "fixtures/proc_mounts"
+	ProcMountInfoPath = "fixtures/mountinfo"
 
-	expectedMounts := []string{"/homes/tux"}
+	expectedMounts := []string{"/homes/tux", "/mnt/cluster", "/mnt/sshfs", "/net", "/net/fileserver/data", "/srv/my share"}
 	actualMounts := RemoteMounts()
 
 	if !reflect.DeepEqual(actualMounts, expectedMounts) {
-		t.Errorf("Expected: ", expectedMounts, " Got: ", actualMounts)
+		t.Errorf("RemoteMounts() = '%v', want '%v'", actualMounts, expectedMounts)
+	}
+}
+
+func TestBtrfsMounts(t *testing.T) {
+	ProcMountInfoPath = "fixtures/mountinfo"
+
+	expectedMounts := map[string]string{
+		"/home":       "/@/home",
+		"/.snapshots": "/@/.snapshots",
+		"/srv":        "/@/srv",
+	}
+	actualMounts := BtrfsMounts()
+
+	if !reflect.DeepEqual(actualMounts, expectedMounts) {
+		t.Errorf("BtrfsMounts() = '%v', want '%v'", actualMounts, expectedMounts)
+	}
+}
+
+func TestFileSystemDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var stat syscall.Stat_t
+	if err := syscall.Lstat(dir, &stat); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDevices := map[uint64]bool{uint64(stat.Dev): true}
+	actualDevices := fileSystemDevices([]string{dir, dir + "/missing"})
+	if !reflect.DeepEqual(actualDevices, expectedDevices) {
+		t.Errorf("fileSystemDevices() = '%v', want '%v'", actualDevices, expectedDevices)
 	}
 }
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// An ndjsonTrailer is the last record of the ndjson output. It tells the
+// reader that the output is complete and holds the totals of all entries.
+type ndjsonTrailer struct {
+	Trailer   bool           `json:"trailer"`
+	Extracted bool           `json:"extracted"`
+	Total     int            `json:"total"`
+	Types     map[string]int `json:"types"`
+	Size      int64          `json:"size"`
+	// Delta is set if the entries are the changes since a baseline
+	Delta bool `json:"delta,omitempty"`
+	// Baseline is the id of the baseline which was saved
+	Baseline int64 `json:"baseline,omitempty"`
+}
+
+// An ndjsonWriter streams unmanaged files as newline delimited JSON, one
+// object per line. It is safe for concurrent use.
+type ndjsonWriter struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	trailer ndjsonTrailer
+}
+
+func newNdjsonWriter(w io.Writer) *ndjsonWriter {
+	writer := bufio.NewWriter(w)
+	return &ndjsonWriter{
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+		trailer: ndjsonTrailer{Trailer: true, Types: map[string]int{}},
+	}
+}
+
+func (w *ndjsonWriter) Write(entry UnmanagedFile) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.trailer.Total++
+	w.trailer.Types[entry.Type]++
+	if entry.Size != nil {
+		w.trailer.Size += *entry.Size
+	}
+	return w.encoder.Encode(entry)
+}
+
+// Close writes the trailer and flushes the output
+func (w *ndjsonWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.encoder.Encode(w.trailer); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNdjsonWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := newNdjsonWriter(&output)
+
+	file := UnmanagedFile{Name: "/opt/foo", Type: "file", SizeValue: 12}
+	file.Size = &file.SizeValue
+	dir := UnmanagedFile{Name: "/opt/bar/", Type: "dir", SizeValue: 30}
+	dir.Size = &dir.SizeValue
+
+	writer.Write(file)
+	writer.Write(dir)
+	writer.Write(UnmanagedFile{Name: "/opt/link", Type: "link"})
+	if output.Len() != 0 {
+		t.Errorf("ndjsonWriter should buffer the output until it is flushed")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	want := `{"name":"/opt/foo","type":"file","size":12}
+{"name":"/opt/bar/","type":"dir","size":30}
+{"name":"/opt/link","type":"link"}
+{"trailer":true,"extracted":false,"total":3,"types":{"dir":1,"file":1,"link":1},"size":42}
+`
+	if output.String() != want {
+		t.Errorf("ndjsonWriter output = '%v', want '%v'", output.String(), want)
+	}
+}
@@ -0,0 +1,578 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// whiteout markers of the OCI image layer format
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// the default locations of the package and user databases, which are used in
+// images regardless of the paths set for the inspected system
+var (
+	imageRpmDatabasePaths   = append([]string{}, RpmDatabasePaths...)
+	imageDpkgDatabasePath   = DpkgDatabasePath
+	imageApkDatabasePath    = ApkDatabasePath
+	imagePacmanDatabasePath = PacmanDatabasePath
+	imagePasswdPath         = PasswdPath
+	imageGroupPath          = GroupPath
+)
+
+// imageDatabasePaths are the files and directories whose content is kept when
+// the layers are applied, so the managed files can be read from the image
+var imageDatabasePaths = append(append([]string{}, imageRpmDatabasePaths...), imageDpkgDatabasePath,
+	imageApkDatabasePath, imagePacmanDatabasePath, imagePasswdPath, imageGroupPath)
+
+// An archiveEntry is the position of a file in an uncompressed tar archive
+type archiveEntry struct {
+	offset int64
+	size   int64
+}
+
+// An imageArchive gives access to the blobs of an OCI layout or docker-archive
+// tarball without unpacking it
+type imageArchive struct {
+	file    *os.File
+	entries map[string]archiveEntry
+}
+
+// A countingReader counts the bytes read, which gives the offset of the file
+// data after tar.Reader.Next
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func openImageArchive(name string) (*imageArchive, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &countingReader{r: file}
+	archive := tar.NewReader(counter)
+	entries := make(map[string]archiveEntry)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			entries[path.Clean(header.Name)] = archiveEntry{offset: counter.n, size: header.Size}
+		}
+	}
+	return &imageArchive{file: file, entries: entries}, nil
+}
+
+func (a *imageArchive) Close() error {
+	return a.file.Close()
+}
+
+func (a *imageArchive) open(name string) (io.Reader, error) {
+	entry, ok := a.entries[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing in the image archive", name)
+	}
+	return io.NewSectionReader(a.file, entry.offset, entry.size), nil
+}
+
+func (a *imageArchive) readJSON(name string, v interface{}) error {
+	r, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform"`
+}
+
+// An ociDocument is an image index or an image manifest
+type ociDocument struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// selectManifest picks the manifest for the platform of the helper from an
+// image index and falls back to the first one
+func selectManifest(manifests []ociDescriptor) (ociDescriptor, error) {
+	if len(manifests) == 0 {
+		return ociDescriptor{}, errors.New("the image index does not list any manifest")
+	}
+	for _, manifest := range manifests {
+		if manifest.Platform != nil && manifest.Platform.OS == "linux" &&
+			manifest.Platform.Architecture == runtime.GOARCH {
+			return manifest, nil
+		}
+	}
+	return manifests[0], nil
+}
+
+// layers returns the layer blobs of the first image in the archive from the
+// bottom to the top
+func (a *imageArchive) layers() ([]string, error) {
+	// docker save writes a manifest.json, newer versions in addition to an
+	// OCI layout
+	if _, ok := a.entries["manifest.json"]; ok {
+		var manifest []struct {
+			Layers []string
+		}
+		if err := a.readJSON("manifest.json", &manifest); err != nil {
+			return nil, err
+		}
+		if len(manifest) == 0 {
+			return nil, errors.New("the image archive does not contain an image")
+		}
+		return manifest[0].Layers, nil
+	}
+
+	if _, ok := a.entries["index.json"]; !ok {
+		return nil, errors.New("the file is neither an OCI layout nor a docker-archive")
+	}
+	var document ociDocument
+	if err := a.readJSON("index.json", &document); err != nil {
+		return nil, err
+	}
+	// indexes can be nested, e.g. for multi platform images
+	for document.Layers == nil {
+		manifest, err := selectManifest(document.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		document = ociDocument{}
+		if err := a.readJSON(blobPath(manifest.Digest), &document); err != nil {
+			return nil, err
+		}
+	}
+
+	layers := make([]string, len(document.Layers))
+	for i, layer := range document.Layers {
+		layers[i] = blobPath(layer.Digest)
+	}
+	return layers, nil
+}
+
+// openLayer detects the compression of a layer tarball
+func openLayer(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(buffered)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd compressed layers are not supported")
+	}
+	return buffered, nil
+}
+
+// An imageNode is a file in the merged file system of an image. Only
+// directories have children.
+type imageNode struct {
+	header   *tar.Header
+	content  []byte
+	children map[string]*imageNode
+}
+
+func newImageDir(name string) *imageNode {
+	return &imageNode{
+		header:   &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755},
+		children: make(map[string]*imageNode),
+	}
+}
+
+// An imageFS is the file system of an image with all layers applied. It only
+// holds the metadata of the files and the content of the ones for which keep
+// returns true.
+type imageFS struct {
+	root *imageNode
+	keep func(name string) bool
+}
+
+func newImageFS(keep func(name string) bool) *imageFS {
+	return &imageFS{root: newImageDir("/"), keep: keep}
+}
+
+func (fs *imageFS) lookup(name string) *imageNode {
+	node := fs.root
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if node = node.children[part]; node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// dir returns the directory at name and creates the missing ones
+func (fs *imageFS) dir(name string) *imageNode {
+	node := fs.root
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		child := node.children[part]
+		if child == nil || child.children == nil {
+			child = newImageDir(path.Join(node.header.Name, part))
+			node.children[part] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// applyLayer adds the files of a layer tarball on top of the lower layers and
+// removes the files which are whited out. The whiteouts only apply to the
+// lower layers, so they are applied before any file of the layer is added.
+func (fs *imageFS) applyLayer(r io.Reader) error {
+	var nodes []*imageNode
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+		dirName, base := path.Split(name)
+
+		switch {
+		case base == opaqueWhiteout:
+			fs.dir(dirName).children = make(map[string]*imageNode)
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			delete(fs.dir(dirName).children, strings.TrimPrefix(base, whiteoutPrefix))
+			continue
+		}
+
+		header.Name = name
+		node := &imageNode{header: header}
+		if header.Typeflag == tar.TypeReg && fs.keep(name) {
+			if node.content, err = ioutil.ReadAll(archive); err != nil {
+				return err
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		dirName, base := path.Split(node.header.Name)
+		parent := fs.dir(dirName)
+		if node.header.Typeflag == tar.TypeDir {
+			// the files of the lower layers stay in the directory
+			if existing := parent.children[base]; existing != nil && existing.children != nil {
+				node.children = existing.children
+			} else {
+				node.children = make(map[string]*imageNode)
+			}
+		}
+		parent.children[base] = node
+	}
+	return nil
+}
+
+func (fs *imageFS) readDir(dir string) ([]os.FileInfo, error) {
+	node := fs.lookup(dir)
+	if node == nil || node.children == nil {
+		return nil, &os.PathError{Op: "readdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	files := make([]os.FileInfo, 0, len(node.children))
+	for _, child := range node.children {
+		files = append(files, child.header.FileInfo())
+	}
+	sort.Sort(fileInfosByName(files))
+	return files, nil
+}
+
+func (fs *imageFS) lstat(name string) (os.FileInfo, error) {
+	node := fs.lookup(name)
+	if node == nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: syscall.ENOENT}
+	}
+	return node.header.FileInfo(), nil
+}
+
+func (fs *imageFS) readLink(name string) (string, error) {
+	node := fs.lookup(name)
+	if node == nil || node.header.Typeflag != tar.TypeSymlink {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return node.header.Linkname, nil
+}
+
+// writeKept writes the files whose content was kept below dir
+func (fs *imageFS) writeKept(dir string) error {
+	var write func(node *imageNode) error
+	write = func(node *imageNode) error {
+		if node.content != nil {
+			target := filepath.Join(dir, node.header.Name)
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(target, node.content, 0600); err != nil {
+				return err
+			}
+		}
+		for _, child := range node.children {
+			if err := write(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write(fs.root)
+}
+
+func isImageDatabaseFile(name string) bool {
+	for _, databasePath := range imageDatabasePaths {
+		if name == databasePath || strings.HasPrefix(name, databasePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// useImage redirects the file system access and the package database paths
+// to the image and returns a function which restores them
+func useImage(image *imageFS, databaseDir string) func() {
+	origReadDir, origLstat, origReadLink := readDir, lstat, readLink
+	origRpm, origDpkg, origApk, origPacman :=
+		RpmDatabasePaths, DpkgDatabasePath, ApkDatabasePath, PacmanDatabasePath
+
+	readDir, lstat, readLink = image.readDir, image.lstat, image.readLink
+	RpmDatabasePaths = nil
+	for _, rpmPath := range imageRpmDatabasePaths {
+		RpmDatabasePaths = append(RpmDatabasePaths, filepath.Join(databaseDir, rpmPath))
+	}
+	DpkgDatabasePath = filepath.Join(databaseDir, imageDpkgDatabasePath)
+	ApkDatabasePath = filepath.Join(databaseDir, imageApkDatabasePath)
+	PacmanDatabasePath = filepath.Join(databaseDir, imagePacmanDatabasePath)
+
+	return func() {
+		readDir, lstat, readLink = origReadDir, origLstat, origReadLink
+		RpmDatabasePaths, DpkgDatabasePath, ApkDatabasePath, PacmanDatabasePath =
+			origRpm, origDpkg, origApk, origPacman
+	}
+}
+
+// findImageManagedFilesProvider is like findManagedFilesProvider, but it only
+// detects package managers by their database, the tools of the host know
+// nothing about the image
+func findImageManagedFilesProvider(name string) (ManagedFilesProvider, error) {
+	if name != "" {
+		return findManagedFilesProvider(name)
+	}
+	if hasRpmDatabase() {
+		return rpmProvider{}, nil
+	}
+	for _, provider := range []ManagedFilesProvider{dpkgProvider{}, apkProvider{}, pacmanProvider{}} {
+		if provider.Available() {
+			return provider, nil
+		}
+	}
+	return nil, errors.New("no package database found in the image, use --package-manager to select one")
+}
+
+func newImageUnmanagedFile(image *imageFS, users *idNameCache, groups *idNameCache,
+	name string, fileType string, stats *dirStats) UnmanagedFile {
+	entry := UnmanagedFile{Name: name, Type: fileType}
+	fi, err := image.lstat(name)
+	if err != nil {
+		return entry
+	}
+	header := fi.Sys().(*tar.Header)
+
+	if fileType != "link" {
+		amendMode(&entry, fi.Mode())
+		if stats != nil {
+			amendDirStats(&entry, stats)
+		} else {
+			amendSize(&entry, fi.Size())
+		}
+	}
+	entry.Mtime = header.ModTime.UTC().Format(time.RFC3339Nano)
+	if !header.ChangeTime.IsZero() {
+		entry.Ctime = header.ChangeTime.UTC().Format(time.RFC3339Nano)
+	}
+
+	var userResolved, groupResolved bool
+	entry.User, userResolved = users.lookup(uint32(header.Uid))
+	entry.Group, groupResolved = groups.lookup(uint32(header.Gid))
+	entry.Orphaned = !userResolved || !groupResolved
+
+	// the reader fills Xattrs from the SCHILY.xattr PAX records
+	for xattr, value := range header.Xattrs {
+		if isRecordedXattr(xattr) {
+			if entry.Xattrs == nil {
+				entry.Xattrs = make(map[string][]byte)
+			}
+			entry.Xattrs[xattr] = []byte(value)
+		}
+	}
+	return entry
+}
+
+// inspectImage finds the unmanaged files of a container image in an OCI
+// layout or docker-archive tarball. The layers are applied in memory and the
+// package database is read from the image.
+func inspectImage(name string, packageManager string, extractMetadata bool) ([]UnmanagedFile, error) {
+	archive, err := openImageArchive(name)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	layers, err := archive.layers()
+	if err != nil {
+		return nil, err
+	}
+	image := newImageFS(isImageDatabaseFile)
+	for _, layer := range layers {
+		r, err := archive.open(layer)
+		if err == nil {
+			r, err = openLayer(r)
+		}
+		if err == nil {
+			err = image.applyLayer(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading the layer %s failed: %v", layer, err)
+		}
+	}
+
+	databaseDir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(databaseDir)
+	if err := image.writeKept(databaseDir); err != nil {
+		return nil, err
+	}
+	defer useImage(image, databaseDir)()
+
+	provider, err := findImageManagedFilesProvider(packageManager)
+	if err != nil {
+		return nil, err
+	}
+	managedFiles, managedDirs, err := provider.ManagedFiles()
+	if err != nil {
+		return nil, fmt.Errorf("reading the managed files from %s failed: %v", provider.Name(), err)
+	}
+
+	walker := newUnmanagedFilesWalker(managedFiles, managedDirs, map[string]bool{}, runtime.NumCPU())
+	walker.WithDirStats = extractMetadata
+	walker.Walk("/")
+
+	files := make([]string, 0, len(walker.UnmanagedFiles))
+	for file := range walker.UnmanagedFiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	// the ids are resolved with the user database of the image only
+	passwdPath := filepath.Join(databaseDir, imagePasswdPath)
+	groupPath := filepath.Join(databaseDir, imageGroupPath)
+	noLookup := func(id string) (string, error) { return "", errors.New("not in the image") }
+	users := newIDNameCache(&passwdPath, noLookup)
+	groups := newIDNameCache(&groupPath, noLookup)
+
+	unmanagedFiles := make([]UnmanagedFile, 0, len(files))
+	for _, file := range files {
+		if extractMetadata {
+			unmanagedFiles = append(unmanagedFiles, newImageUnmanagedFile(image, users, groups,
+				file, walker.UnmanagedFiles[file], walker.DirStats[file]))
+		} else {
+			unmanagedFiles = append(unmanagedFiles, UnmanagedFile{Name: file, Type: walker.UnmanagedFiles[file]})
+		}
+	}
+	return unmanagedFiles, nil
+}
+
+// OciInspect prints the unmanaged files of a container image tarball
+func OciInspect(args []string) {
+	ociInspectCommand := flag.NewFlagSet("oci-inspect", flag.ExitOnError)
+	packageManagerFlag := ociInspectCommand.String("package-manager", "",
+		"use the given package manager instead of detecting it from the database in the image")
+	extractMetadataFlag := ociInspectCommand.Bool("extract-metadata", false, "extracts metadata of the files")
+	ociInspectCommand.Parse(args)
+
+	if ociInspectCommand.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Error: oci-inspect expects the path of an image tarball")
+		os.Exit(1)
+	}
+
+	files, err := inspectImage(ociInspectCommand.Arg(0), *packageManagerFlag, *extractMetadataFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(assembleJSON(files))
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+	uid      int
+}
+
+func buildTestTar(t *testing.T, entries []testTarEntry, compress bool) []byte {
+	var archive bytes.Buffer
+	var writer *tar.Writer
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(&archive)
+		writer = tar.NewWriter(gzipWriter)
+	} else {
+		writer = tar.NewWriter(&archive)
+	}
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.content)),
+			Uid:      entry.uid,
+		}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(entry.content))
+	}
+	writer.Close()
+	if gzipWriter != nil {
+		gzipWriter.Close()
+	}
+	return archive.Bytes()
+}
+
+func testImageLayers(t *testing.T) [][]byte {
+	base := buildTestTar(t, []testTarEntry{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/passwd", typeflag: tar.TypeReg, content: "root:x:0:0:root:/root:/bin/sh\n"},
+		{name: "etc/group", typeflag: tar.TypeReg, content: "root:x:0:\n"},
+		{name: "etc/foo.conf", typeflag: tar.TypeReg},
+		{name: "usr/bin/foo", typeflag: tar.TypeReg},
+		{name: "var/lib/dpkg/status", typeflag: tar.TypeReg,
+			content: "Package: foo\nStatus: install ok installed\nVersion: 1.0\n\n"},
+		{name: "var/lib/dpkg/info/foo.list", typeflag: tar.TypeReg,
+			content: "/.\n/etc\n/etc/foo.conf\n/usr\n/usr/bin\n/usr/bin/foo\n"},
+		{name: "opt/old/a", typeflag: tar.TypeReg, content: "a"},
+		{name: "srv/data/x", typeflag: tar.TypeReg, content: "x"},
+	}, false)
+	top := buildTestTar(t, []testTarEntry{
+		{name: "opt/.wh.old", typeflag: tar.TypeReg},
+		{name: "srv/data/", typeflag: tar.TypeDir},
+		{name: "srv/data/.wh..wh..opq", typeflag: tar.TypeReg},
+		{name: "srv/data/z", typeflag: tar.TypeReg, content: "zzz"},
+		{name: "usr/bin/bar", typeflag: tar.TypeReg, content: "bar", uid: 1000},
+		{name: "etc/link", typeflag: tar.TypeSymlink, linkname: "foo.conf"},
+	}, true)
+	return [][]byte{base, top}
+}
+
+func writeTestImage(t *testing.T, files map[string][]byte) string {
+	var entries []testTarEntry
+	for name, content := range files {
+		entries = append(entries, testTarEntry{name: name, typeflag: tar.TypeReg, content: string(content)})
+	}
+	file, err := ioutil.TempFile("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(buildTestTar(t, entries, false))
+	file.Close()
+	return file.Name()
+}
+
+func TestInspectDockerArchive(t *testing.T) {
+	layers := testImageLayers(t)
+	manifest, _ := json.Marshal([]map[string]interface{}{{
+		"Config":   "config.json",
+		"RepoTags": []string{"test:latest"},
+		"Layers":   []string{"base/layer.tar", "top/layer.tar"},
+	}})
+	image := writeTestImage(t, map[string][]byte{
+		"manifest.json":  manifest,
+		"config.json":    []byte("{}"),
+		"base/layer.tar": layers[0],
+		"top/layer.tar":  layers[1],
+	})
+	defer os.Remove(image)
+
+	files, err := inspectImage(image, "", false)
+	if err != nil {
+		t.Fatalf("inspectImage() failed: %v", err)
+	}
+
+	want := []UnmanagedFile{
+		{Name: "/etc/group", Type: "file"},
+		{Name: "/etc/link", Type: "link"},
+		{Name: "/etc/passwd", Type: "file"},
+		{Name: "/opt/", Type: "dir"},
+		{Name: "/srv/", Type: "dir"},
+		{Name: "/usr/bin/bar", Type: "file"},
+		{Name: "/var/", Type: "dir"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("inspectImage() = '%v', want '%v'", files, want)
+	}
+}
+
+func TestInspectOciLayout(t *testing.T) {
+	blobs := map[string][]byte{}
+	addBlob := func(content []byte) string {
+		sum := sha256.Sum256(content)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		blobs[blobPath(digest)] = content
+		return digest
+	}
+
+	var layers []map[string]string
+	for _, layer := range testImageLayers(t) {
+		layers = append(layers, map[string]string{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar",
+			"digest":    addBlob(layer),
+		})
+	}
+	manifest, _ := json.Marshal(map[string]interface{}{"layers": layers})
+	otherManifest, _ := json.Marshal(map[string]interface{}{"layers": []string{}})
+	index, _ := json.Marshal(map[string]interface{}{"manifests": []map[string]interface{}{
+		{"digest": addBlob(otherManifest), "platform": map[string]string{"os": "linux", "architecture": "other"}},
+		{"digest": addBlob(manifest), "platform": map[string]string{"os": "linux", "architecture": runtime.GOARCH}},
+	}})
+	blobs["index.json"], _ = json.Marshal(map[string]interface{}{"manifests": []map[string]string{
+		{"digest": addBlob(index)},
+	}})
+	blobs["oci-layout"] = []byte(`{"imageLayoutVersion": "1.0.0"}`)
+
+	image := writeTestImage(t, blobs)
+	defer os.Remove(image)
+
+	files, err := inspectImage(image, "dpkg", true)
+	if err != nil {
+		t.Fatalf("inspectImage() failed: %v", err)
+	}
+
+	entries := map[string]UnmanagedFile{}
+	for _, file := range files {
+		entries[file.Name] = file
+	}
+	if len(entries) != 7 {
+		t.Errorf("inspectImage() = '%v', want 7 files", files)
+	}
+
+	srv := entries["/srv/"]
+	if srv.FilesValue != 1 || srv.DirsValue != 1 || srv.SizeValue != 3 {
+		t.Errorf("/srv/ has %d files, %d dirs, %d bytes, want 1, 1, 3",
+			srv.FilesValue, srv.DirsValue, srv.SizeValue)
+	}
+	if passwd := entries["/etc/passwd"]; passwd.User != "root" || passwd.Group != "root" || passwd.Orphaned {
+		t.Errorf("/etc/passwd = '%+v', want owned by root", passwd)
+	}
+	if bar := entries["/usr/bin/bar"]; bar.User != "1000" || !bar.Orphaned || bar.Mode != "644" {
+		t.Errorf("/usr/bin/bar = '%+v', want owned by the orphaned uid 1000", bar)
+	}
+}
+
+func TestApplyLayerOpaqueWhiteout(t *testing.T) {
+	lower := buildTestTar(t, []testTarEntry{
+		{name: "srv/data/x", typeflag: tar.TypeReg},
+		{name: "srv/data/sub/y", typeflag: tar.TypeReg},
+	}, false)
+	upper := buildTestTar(t, []testTarEntry{
+		{name: "srv/data/", typeflag: tar.TypeDir},
+		{name: "srv/data/sub/", typeflag: tar.TypeDir},
+		{name: "srv/data/z", typeflag: tar.TypeReg},
+		{name: "srv/data/.wh..wh..opq", typeflag: tar.TypeReg},
+	}, false)
+
+	image := newImageFS(func(string) bool { return false })
+	for _, layer := range [][]byte{lower, upper} {
+		if err := image.applyLayer(bytes.NewReader(layer)); err != nil {
+			t.Fatalf("applyLayer() failed: %v", err)
+		}
+	}
+
+	for dir, want := range map[string][]string{
+		"/srv/data":     {"sub", "z"},
+		"/srv/data/sub": {},
+	} {
+		files, err := image.readDir(dir)
+		if err != nil {
+			t.Fatalf("readDir('%v') failed: %v", dir, err)
+		}
+		names := []string{}
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("readDir('%v') = '%v', want '%v'", dir, names, want)
+		}
+	}
+}
+
+func TestInspectImageErrors(t *testing.T) {
+	image := writeTestImage(t, map[string][]byte{"foo": []byte("bar")})
+	defer os.Remove(image)
+
+	if _, err := inspectImage(image, "", false); err == nil {
+		t.Errorf("inspectImage() of a tarball which is no image should fail")
+	}
+	if _, err := inspectImage("/does/not/exist.tar", "", false); err == nil {
+		t.Errorf("inspectImage() of a missing file should fail")
+	}
+}
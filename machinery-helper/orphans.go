@@ -0,0 +1,126 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// An OrphanedFile is a managed or unmanaged file whose owner or group does not
+// exist on the system. The missing ids are given as numbers.
+type OrphanedFile struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	User          string `json:"user"`
+	Group         string `json:"group"`
+	Managed       bool   `json:"managed"`
+	OrphanedUser  bool   `json:"orphaned_user,omitempty"`
+	OrphanedGroup bool   `json:"orphaned_group,omitempty"`
+}
+
+// newOrphanedFile returns the entry for a file if its owner or its group can
+// not be resolved
+func newOrphanedFile(name string, fileType string, managed bool) (OrphanedFile, bool) {
+	fi, err := os.Lstat(strings.TrimSuffix(name, "/"))
+	if err != nil {
+		return OrphanedFile{}, false
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || !isOrphaned(stat.Uid, stat.Gid) {
+		return OrphanedFile{}, false
+	}
+
+	entry := OrphanedFile{Name: name, Type: fileType, Managed: managed}
+	var userResolved, groupResolved bool
+	entry.User, userResolved = userNames.lookup(stat.Uid)
+	entry.Group, groupResolved = groupNames.lookup(stat.Gid)
+	entry.OrphanedUser = !userResolved
+	entry.OrphanedGroup = !groupResolved
+	return entry, true
+}
+
+// findOrphanedFiles walks the roots with the walker, including the managed
+// files, and returns the files whose owner or group can not be resolved
+func findOrphanedFiles(walker *unmanagedFilesWalker, roots []string) []OrphanedFile {
+	var mutex sync.Mutex
+	orphans := make(map[string]OrphanedFile)
+	walker.IncludeManaged = true
+	walker.Found = func(name string, fileType string, stats *dirStats) {
+		var managed bool
+		if fileType == "dir" {
+			_, managed = walker.ManagedDirs[strings.TrimSuffix(name, "/")]
+		} else {
+			_, managed = walker.ManagedFiles[name]
+		}
+		if entry, ok := newOrphanedFile(name, fileType, managed); ok {
+			mutex.Lock()
+			orphans[name] = entry
+			mutex.Unlock()
+		}
+	}
+	for _, root := range roots {
+		walker.WalkRoot(root)
+	}
+
+	names := make([]string, 0, len(orphans))
+	for name := range orphans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	orphanedFiles := make([]OrphanedFile, len(names))
+	for i, name := range names {
+		orphanedFiles[i] = orphans[name]
+	}
+	return orphanedFiles
+}
+
+// Orphans prints the managed and unmanaged files whose owner or group does not
+// exist on the system
+func Orphans(args []string) {
+	orphansCommand := flag.NewFlagSet("orphans", flag.ExitOnError)
+	packageManagerFlag := orphansCommand.String("package-manager", "",
+		"use the given package manager for finding managed files instead of detecting it")
+	orphansCommand.StringVar(&ManifestPath, "manifest", "",
+		"file listing managed paths for the 'manifest' package manager")
+	walkOptions := addWalkFlags(orphansCommand)
+	orphansCommand.Parse(args)
+
+	if err := walkOptions.parse(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if err := walkOptions.enterSystem(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	managedFiles, managedDirs, err := getManagedFiles(*packageManagerFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	walker := walkOptions.newWalker(managedFiles, managedDirs)
+	fmt.Println(assembleJSON(findOrphanedFiles(walker, walkOptions.Roots)))
+}
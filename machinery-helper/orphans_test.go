@@ -0,0 +1,79 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindOrphanedFiles(t *testing.T) {
+	readDir = ioutil.ReadDir
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "managed", "sub"), 0755)
+	os.Mkdir(filepath.Join(dir, "ignored"), 0755)
+	for _, file := range []string{"managed/foo", "managed/sub/bar", "unmanaged", "ignored/baz", "excluded"} {
+		ioutil.WriteFile(filepath.Join(dir, file), []byte{}, 0644)
+	}
+	os.Symlink("unmanaged", filepath.Join(dir, "link"))
+
+	owners := map[string][2]int{
+		"managed/foo":     {4242, 0},
+		"managed/sub":     {0, 4343},
+		"managed/sub/bar": {0, 0},
+		"unmanaged":       {4242, 4343},
+		"link":            {4242, 0},
+		"ignored/baz":     {4242, 4343},
+		"excluded":        {4242, 4343},
+	}
+	for file, owner := range owners {
+		if err := os.Lchown(filepath.Join(dir, file), owner[0], owner[1]); err != nil {
+			t.Skip("changing the owner of files is not permitted:", err)
+		}
+	}
+
+	managedFiles := map[string]string{filepath.Join(dir, "managed", "foo"): ""}
+	managedDirs := map[string]bool{
+		filepath.Join(dir, "managed"):        true,
+		filepath.Join(dir, "managed", "sub"): true,
+	}
+	ignoreList := map[string]bool{filepath.Join(dir, "ignored"): true}
+
+	walker := newUnmanagedFilesWalker(managedFiles, managedDirs, ignoreList, 4)
+	walker.IgnoreRules, _ = newIgnoreRules([]string{"excluded"})
+
+	want := []OrphanedFile{
+		{Name: dir + "/link", Type: "link", User: "4242", Group: "root", OrphanedUser: true},
+		{Name: dir + "/managed/foo", Type: "file", User: "4242", Group: "root", Managed: true, OrphanedUser: true},
+		{Name: dir + "/managed/sub/", Type: "dir", User: "root", Group: "4343", Managed: true, OrphanedGroup: true},
+		{Name: dir + "/unmanaged", Type: "file", User: "4242", Group: "4343", OrphanedUser: true, OrphanedGroup: true},
+	}
+	actual := findOrphanedFiles(walker, []string{dir})
+	if !reflect.DeepEqual(actual, want) {
+		t.Errorf("findOrphanedFiles() = '%v', want '%v'", actual, want)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PacmanDatabasePath is the local database of installed Arch Linux packages.
+// This needs to be exported for the test cases
+var PacmanDatabasePath = "/var/lib/pacman/local"
+
+// A pacmanPackage is an installed package with the directories and files it
+// owns as absolute paths.
+type pacmanPackage struct {
+	Name    string
+	Version string
+	Dirs    []string
+	Files   []string
+	// Backup maps the files which are preserved on upgrades to their md5sums
+	Backup map[string]string
+}
+
+// parsePacmanSections reads the "%SECTION%" blocks of the desc and files
+// entries of the pacman database.
+func parsePacmanSections(r io.Reader) (map[string][]string, error) {
+	sections := make(map[string][]string)
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			section = ""
+		case strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%") && len(line) > 2:
+			section = strings.Trim(line, "%")
+			sections[section] = []string{}
+		case section != "":
+			sections[section] = append(sections[section], line)
+		}
+	}
+	return sections, scanner.Err()
+}
+
+func readPacmanSections(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parsePacmanSections(file)
+}
+
+func readPacmanPackage(dir string) (pacmanPackage, error) {
+	pkg := pacmanPackage{Backup: make(map[string]string)}
+
+	desc, err := readPacmanSections(filepath.Join(dir, "desc"))
+	if err != nil {
+		return pkg, err
+	}
+	if name := desc["NAME"]; len(name) > 0 {
+		pkg.Name = name[0]
+	}
+	if version := desc["VERSION"]; len(version) > 0 {
+		pkg.Version = version[0]
+	}
+
+	files, err := readPacmanSections(filepath.Join(dir, "files"))
+	if os.IsNotExist(err) {
+		return pkg, nil
+	}
+	if err != nil {
+		return pkg, err
+	}
+
+	// paths are relative to the root, directories end with a slash
+	for _, file := range files["FILES"] {
+		if strings.HasSuffix(file, "/") {
+			pkg.Dirs = append(pkg.Dirs, path.Join("/", file))
+		} else {
+			pkg.Files = append(pkg.Files, path.Join("/", file))
+		}
+	}
+	for _, line := range files["BACKUP"] {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) == 2 {
+			pkg.Backup[path.Join("/", fields[0])] = fields[1]
+		}
+	}
+	return pkg, nil
+}
+
+func readPacmanDatabase() ([]pacmanPackage, error) {
+	entries, err := ioutil.ReadDir(PacmanDatabasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []pacmanPackage
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pkg, err := readPacmanPackage(filepath.Join(PacmanDatabasePath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+func hasPacmanDatabase() bool {
+	_, err := os.Stat(filepath.Join(PacmanDatabasePath, "ALPM_DB_VERSION"))
+	return err == nil
+}
+
+func getManagedFilesPacman() (map[string]string, map[string]bool, error) {
+	files := make(map[string]string)
+	dirs := make(map[string]bool)
+
+	packages, err := readPacmanDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pkg := range packages {
+		for _, dir := range pkg.Dirs {
+			dirs[dir] = true
+		}
+		for _, file := range pkg.Files {
+			// pacman does not record the file type, symlinks are recognized on disk
+			target, _ := readLink(file)
+			files[file] = target
+		}
+	}
+
+	addImplicitlyManagedDirs(dirs, files)
+
+	return files, dirs, nil
+}
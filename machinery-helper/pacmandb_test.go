@@ -0,0 +1,90 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReadPacmanDatabase(t *testing.T) {
+	PacmanDatabasePath = "fixtures/pacman/local"
+
+	packages, err := readPacmanDatabase()
+	if err != nil {
+		t.Fatalf("readPacmanDatabase() failed: %v", err)
+	}
+	if len(packages) != 2 {
+		t.Fatalf("readPacmanDatabase() returned %d packages, want 2", len(packages))
+	}
+
+	pacman := packages[1]
+	if pacman.Name != "pacman" || pacman.Version != "6.0.2-7" {
+		t.Errorf("readPacmanDatabase() parsed '%v-%v', want 'pacman-6.0.2-7'", pacman.Name, pacman.Version)
+	}
+	wantBackup := map[string]string{
+		"/etc/makepkg.conf": "37e4bd1a7f5ab1b6ae2bd0ad7fd4c4d2",
+		"/etc/pacman.conf":  "2b25d2d1e7a0e2b2a0b0c8e8a0b4c9f6",
+	}
+	if !reflect.DeepEqual(pacman.Backup, wantBackup) {
+		t.Errorf("pacman.Backup = '%v', want '%v'", pacman.Backup, wantBackup)
+	}
+}
+
+func TestGetManagedFilesPacman(t *testing.T) {
+	PacmanDatabasePath = "fixtures/pacman/local"
+	readLink = func(path string) (string, error) {
+		switch path {
+		case "/bin":
+			return "usr/bin", nil
+		case "/lib64":
+			return "/usr/lib", nil
+		}
+		return "", errors.New("invalid argument")
+	}
+
+	files, dirs, err := getManagedFilesPacman()
+	if err != nil {
+		t.Fatalf("getManagedFilesPacman() failed: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"/bin":                   "usr/bin",
+		"/lib64":                 "/usr/lib",
+		"/etc/hostname":          "",
+		"/etc/makepkg.conf":      "",
+		"/etc/pacman.conf":       "",
+		"/usr/bin/pacman":        "",
+		"/usr/bin/repo-elephant": "",
+		"/usr/bin/repo-remove":   "",
+	}
+	wantDirs := map[string]bool{
+		"/etc":     true,
+		"/usr":     true,
+		"/usr/bin": true,
+		"/usr/lib": true,
+		"/lib64":   false,
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("getManagedFilesPacman() files = '%v', want '%v'", files, wantFiles)
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("getManagedFilesPacman() dirs = '%v', want '%v'", dirs, wantDirs)
+	}
+}
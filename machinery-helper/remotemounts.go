@@ -0,0 +1,141 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FstabPath is the table of the file systems mounted at boot. This needs to
+// be exported for the test cases
+var FstabPath = "/etc/fstab"
+
+// A RemoteMount describes a remote mount, so it can be recreated on another
+// system
+type RemoteMount struct {
+	FSType string `json:"fs_type"`
+	// Server is the host serving the export, it is empty for file systems
+	// like autofs which are not served by a host
+	Server  string `json:"server,omitempty"`
+	Export  string `json:"export"`
+	Options string `json:"options"`
+	// Origin is "fstab", "autofs" or "manual"
+	Origin string `json:"origin"`
+}
+
+// splitMountSource splits the source of a mount into the server and the
+// export like "host:/export" for nfs or "//host/share" for cifs
+func splitMountSource(source string) (string, string) {
+	if strings.HasPrefix(source, "//") {
+		parts := strings.SplitN(source[2:], "/", 2)
+		if len(parts) == 2 {
+			return parts[0], "/" + parts[1]
+		}
+		return parts[0], "/"
+	}
+	if i := strings.Index(source, ":/"); i > 0 {
+		return source[:i], source[i+1:]
+	}
+	return "", source
+}
+
+// mergeMountOptions returns the options of the mount point followed by the
+// ones of the file system which are not given already
+func mergeMountOptions(mount mountInfo) string {
+	var options []string
+	seen := make(map[string]bool)
+	for _, option := range strings.Split(mount.Options+","+mount.SuperOptions, ",") {
+		if option != "" && !seen[option] {
+			seen[option] = true
+			options = append(options, option)
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+// readFstabMountPoints returns the mount points listed in the fstab
+func readFstabMountPoints() map[string]bool {
+	mountPoints := make(map[string]bool)
+
+	file, err := os.Open(FstabPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "Could not read", FstabPath+":", err)
+		}
+		return mountPoints
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		mountPoint := unescapeMountPath(fields[1])
+		if mountPoint != "/" {
+			mountPoint = strings.TrimSuffix(mountPoint, "/")
+		}
+		mountPoints[mountPoint] = true
+	}
+	return mountPoints
+}
+
+// describeRemoteMounts maps the mount points of the remote mounts to their
+// description. A mount at or below an autofs mount point was mounted by the
+// automounter unless it is listed in the fstab.
+func describeRemoteMounts() map[string]*RemoteMount {
+	fstab := readFstabMountPoints()
+	var autofsMountPoints []string
+	for _, mount := range readMounts() {
+		if mount.FSType == "autofs" {
+			autofsMountPoints = append(autofsMountPoints, mount.MountPoint)
+		}
+	}
+
+	mounts := make(map[string]*RemoteMount)
+	for path, mount := range visibleMounts() {
+		if classifyMount(mount) != remoteFileSystem {
+			continue
+		}
+
+		server, export := splitMountSource(mount.Source)
+		remoteMount := &RemoteMount{
+			FSType:  mount.FSType,
+			Server:  server,
+			Export:  export,
+			Options: mergeMountOptions(mount),
+			Origin:  "manual",
+		}
+		if fstab[path] {
+			remoteMount.Origin = "fstab"
+		} else {
+			for _, autofsMountPoint := range autofsMountPoints {
+				if path == autofsMountPoint || strings.HasPrefix(path, autofsMountPoint+"/") {
+					remoteMount.Origin = "autofs"
+					break
+				}
+			}
+		}
+		mounts[path] = remoteMount
+	}
+	return mounts
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitMountSource(t *testing.T) {
+	expected := map[string][2]string{
+		"host:/real-home/tux":  {"host", "/real-home/tux"},
+		"[fe80::1]:/export":    {"[fe80::1]", "/export"},
+		"//server/my share":    {"server", "/my share"},
+		"//server":             {"server", "/"},
+		"tux@host:/srv":        {"tux@host", "/srv"},
+		"mon1,mon2:6789:/data": {"mon1,mon2:6789", "/data"},
+		"/etc/auto.net":        {"", "/etc/auto.net"},
+	}
+	for source, want := range expected {
+		server, export := splitMountSource(source)
+		if [2]string{server, export} != want {
+			t.Errorf("splitMountSource('%v') = '%v', '%v', want '%v'", source, server, export, want)
+		}
+	}
+}
+
+func TestDescribeRemoteMounts(t *testing.T) {
+	ProcMountInfoPath = "fixtures/mountinfo"
+	FstabPath = "fixtures/fstab"
+	defer func() { FstabPath = "/etc/fstab" }()
+
+	expectedMounts := map[string]*RemoteMount{
+		"/homes/tux": {
+			FSType:  "nfs",
+			Server:  "host",
+			Export:  "/real-home/tux",
+			Options: "rw,nosuid,relatime,vers=4.2,addr=192.168.0.1",
+			Origin:  "fstab",
+		},
+		"/srv/my share": {
+			FSType:  "cifs",
+			Server:  "server",
+			Export:  "/my share",
+			Options: "rw,vers=3.0",
+			Origin:  "manual",
+		},
+		"/mnt/sshfs": {
+			FSType:  "fuse.sshfs",
+			Server:  "tux@host",
+			Export:  "/srv",
+			Options: "rw,nosuid,nodev,relatime,user_id=0,group_id=0",
+			Origin:  "manual",
+		},
+		"/mnt/cluster": {
+			FSType:  "clusterfs",
+			Server:  "server",
+			Export:  "/volume",
+			Options: "rw,relatime,addr=192.168.0.2",
+			Origin:  "manual",
+		},
+		"/net": {
+			FSType:  "autofs",
+			Export:  "/etc/auto.net",
+			Options: "rw,relatime,fd=7,pgrp=1,timeout=300,direct",
+			Origin:  "autofs",
+		},
+		"/net/fileserver/data": {
+			FSType:  "nfs4",
+			Server:  "fileserver",
+			Export:  "/data",
+			Options: "rw,nosuid,relatime,vers=4.2,hard,addr=192.168.0.3",
+			Origin:  "autofs",
+		},
+	}
+
+	actualMounts := describeRemoteMounts()
+	if !reflect.DeepEqual(actualMounts, expectedMounts) {
+		for path, mount := range actualMounts {
+			if !reflect.DeepEqual(mount, expectedMounts[path]) {
+				t.Errorf("describeRemoteMounts()['%v'] = '%+v', want '%+v'", path, mount, expectedMounts[path])
+			}
+		}
+		if len(actualMounts) != len(expectedMounts) {
+			t.Errorf("describeRemoteMounts() = '%v', want '%v'", actualMounts, expectedMounts)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RpmDatabasePaths lists the directories which are searched for the rpm
+// database. This needs to be exported for the test cases
+var RpmDatabasePaths = []string{"/usr/lib/sysimage/rpm", "/var/lib/rpm"}
+
+// rpm header tags used by the helper (see rpmtag.h)
+const (
+	rpmTagName           = 1000
+	rpmTagVersion        = 1001
+	rpmTagRelease        = 1002
+	rpmTagArch           = 1022
+	rpmTagOldFileNames   = 1027
+	rpmTagFileSizes      = 1028
+	rpmTagFileStates     = 1029
+	rpmTagFileModes      = 1030
+	rpmTagFileMtimes     = 1034
+	rpmTagFileDigests    = 1035
+	rpmTagFileLinkTos    = 1036
+	rpmTagFileFlags      = 1037
+	rpmTagFileUserName   = 1039
+	rpmTagFileGroupName  = 1040
+	rpmTagDirIndexes     = 1116
+	rpmTagBaseNames      = 1117
+	rpmTagDirNames       = 1118
+	rpmTagLongFileSizes  = 5008
+	rpmTagFileDigestAlgo = 5011
+)
+
+// rpm header data types
+const (
+	rpmTypeChar        = 1
+	rpmTypeInt8        = 2
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// file type bits of the rpm file modes
+const (
+	rpmFileTypeMask = 0170000
+	rpmFileTypeDir  = 0040000
+	rpmFileTypeReg  = 0100000
+	rpmFileTypeLink = 0120000
+)
+
+// file flags (see rpmfiles.h)
+const (
+	rpmFileConfig    = 1 << 0
+	rpmFileMissingOk = 1 << 3
+	rpmFileGhost     = 1 << 6
+)
+
+// file states, files in any other state than normal are not installed by
+// the package
+const (
+	rpmFileStateNormal   = 0
+	rpmFileStateReplaced = 1
+)
+
+// digest algorithms of the file digests (see rpmpgp.h)
+const (
+	rpmDigestMD5    = 1
+	rpmDigestSHA1   = 2
+	rpmDigestSHA256 = 8
+	rpmDigestSHA384 = 9
+	rpmDigestSHA512 = 10
+)
+
+// sanity limits taken from rpm's header.c
+const (
+	rpmHeaderMaxEntries = 0x0000ffff
+	rpmHeaderMaxData    = 0x0fffffff
+)
+
+type rpmHeaderEntry struct {
+	Type   uint32
+	Offset uint32
+	Count  uint32
+}
+
+type rpmHeader struct {
+	entries map[uint32]rpmHeaderEntry
+	data    []byte
+}
+
+// An rpmFile is a file entry of an installed package as recorded in the
+// rpm database.
+type rpmFile struct {
+	Name       string
+	Mode       uint16
+	Size       int64
+	User       string
+	Group      string
+	Mtime      int64
+	Digest     string
+	LinkTarget string
+	Flags      int32
+	State      int8
+}
+
+// An rpmPackage is an installed package with its file list.
+type rpmPackage struct {
+	Name       string
+	Version    string
+	Release    string
+	Arch       string
+	DigestAlgo int32
+	Files      []rpmFile
+}
+
+func parseRpmHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, errors.New("rpm header is too short")
+	}
+	indexLength := binary.BigEndian.Uint32(blob[0:4])
+	dataLength := binary.BigEndian.Uint32(blob[4:8])
+	if indexLength > rpmHeaderMaxEntries || dataLength > rpmHeaderMaxData {
+		return nil, errors.New("rpm header exceeds the size limits")
+	}
+	dataStart := 8 + 16*int(indexLength)
+	if len(blob) < dataStart+int(dataLength) {
+		return nil, errors.New("rpm header is truncated")
+	}
+
+	header := &rpmHeader{
+		entries: make(map[uint32]rpmHeaderEntry, indexLength),
+		data:    blob[dataStart : dataStart+int(dataLength)],
+	}
+	for i := 0; i < int(indexLength); i++ {
+		entry := blob[8+16*i : 8+16*(i+1)]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		header.entries[tag] = rpmHeaderEntry{
+			Type:   binary.BigEndian.Uint32(entry[4:8]),
+			Offset: binary.BigEndian.Uint32(entry[8:12]),
+			Count:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+	}
+	return header, nil
+}
+
+// entry returns the header entry of the given tag if it exists, has one of
+// the given types and its offset points into the data store.
+func (h *rpmHeader) entry(tag uint32, types ...uint32) (rpmHeaderEntry, bool) {
+	entry, ok := h.entries[tag]
+	if !ok || entry.Offset >= uint32(len(h.data)) {
+		return entry, false
+	}
+	for _, t := range types {
+		if entry.Type == t {
+			return entry, true
+		}
+	}
+	return entry, false
+}
+
+func (h *rpmHeader) strings(tag uint32) []string {
+	entry, ok := h.entry(tag, rpmTypeString, rpmTypeStringArray, rpmTypeI18NString)
+	if !ok {
+		return nil
+	}
+	if entry.Count > uint32(len(h.data)) {
+		return nil
+	}
+
+	values := make([]string, 0, entry.Count)
+	data := h.data[entry.Offset:]
+	for i := uint32(0); i < entry.Count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+func (h *rpmHeader) string(tag uint32) string {
+	values := h.strings(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// integers returns the values of an integer tag of any width as int64
+func (h *rpmHeader) integers(tag uint32) []int64 {
+	entry, ok := h.entry(tag, rpmTypeChar, rpmTypeInt8, rpmTypeInt16, rpmTypeInt32, rpmTypeInt64)
+	if !ok {
+		return nil
+	}
+
+	width := map[uint32]uint32{
+		rpmTypeChar: 1, rpmTypeInt8: 1, rpmTypeInt16: 2, rpmTypeInt32: 4, rpmTypeInt64: 8,
+	}[entry.Type]
+	if uint64(entry.Offset)+uint64(entry.Count)*uint64(width) > uint64(len(h.data)) {
+		return nil
+	}
+
+	values := make([]int64, entry.Count)
+	data := h.data[entry.Offset:]
+	for i := range values {
+		switch width {
+		case 1:
+			values[i] = int64(data[i])
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(data[2*i:]))
+		case 4:
+			values[i] = int64(int32(binary.BigEndian.Uint32(data[4*i:])))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(data[8*i:]))
+		}
+	}
+	return values
+}
+
+func (h *rpmHeader) fileNames() ([]string, error) {
+	baseNames := h.strings(rpmTagBaseNames)
+	if baseNames == nil {
+		return h.strings(rpmTagOldFileNames), nil
+	}
+
+	dirNames := h.strings(rpmTagDirNames)
+	dirIndexes := h.integers(rpmTagDirIndexes)
+	if len(dirIndexes) != len(baseNames) {
+		return nil, errors.New("number of dir indexes does not match the number of base names")
+	}
+
+	names := make([]string, len(baseNames))
+	for i, baseName := range baseNames {
+		index := dirIndexes[i]
+		if index < 0 || index >= int64(len(dirNames)) {
+			return nil, fmt.Errorf("dir index %d of %s is out of range", index, baseName)
+		}
+		names[i] = dirNames[index] + baseName
+	}
+	return names, nil
+}
+
+func parseRpmPackage(blob []byte) (rpmPackage, error) {
+	header, err := parseRpmHeader(blob)
+	if err != nil {
+		return rpmPackage{}, err
+	}
+
+	pkg := rpmPackage{
+		Name:    header.string(rpmTagName),
+		Version: header.string(rpmTagVersion),
+		Release: header.string(rpmTagRelease),
+		Arch:    header.string(rpmTagArch),
+	}
+	if algo := header.integers(rpmTagFileDigestAlgo); len(algo) > 0 {
+		pkg.DigestAlgo = int32(algo[0])
+	}
+
+	names, err := header.fileNames()
+	if err != nil {
+		return pkg, fmt.Errorf("%s: %v", pkg.Name, err)
+	}
+
+	modes := header.integers(rpmTagFileModes)
+	sizes := header.integers(rpmTagLongFileSizes)
+	if sizes == nil {
+		sizes = header.integers(rpmTagFileSizes)
+		for i := range sizes {
+			sizes[i] = int64(uint32(sizes[i]))
+		}
+	}
+	mtimes := header.integers(rpmTagFileMtimes)
+	flags := header.integers(rpmTagFileFlags)
+	states := header.integers(rpmTagFileStates)
+	users := header.strings(rpmTagFileUserName)
+	groups := header.strings(rpmTagFileGroupName)
+	digests := header.strings(rpmTagFileDigests)
+	linkTargets := header.strings(rpmTagFileLinkTos)
+
+	pkg.Files = make([]rpmFile, len(names))
+	for i, name := range names {
+		file := &pkg.Files[i]
+		file.Name = name
+		if len(modes) == len(names) {
+			file.Mode = uint16(modes[i])
+		}
+		if len(sizes) == len(names) {
+			file.Size = sizes[i]
+		}
+		if len(mtimes) == len(names) {
+			file.Mtime = int64(uint32(mtimes[i]))
+		}
+		if len(flags) == len(names) {
+			file.Flags = int32(flags[i])
+		}
+		if len(states) == len(names) {
+			file.State = int8(states[i])
+		}
+		if len(users) == len(names) {
+			file.User = users[i]
+		}
+		if len(groups) == len(names) {
+			file.Group = groups[i]
+		}
+		if len(digests) == len(names) {
+			file.Digest = digests[i]
+		}
+		if len(linkTargets) == len(names) {
+			file.LinkTarget = linkTargets[i]
+		}
+	}
+	return pkg, nil
+}
+
+// findRpmDatabase returns the path and the reader for the first rpm database
+// found in the given directories. Newer backends take precedence in case an
+// old database was left behind by a conversion.
+func findRpmDatabase(dirs []string) (string, func(string) ([][]byte, error), error) {
+	backends := []struct {
+		file   string
+		reader func(string) ([][]byte, error)
+	}{
+		{"rpmdb.sqlite", readSqlitePackages},
+		{"Packages.db", readNdbPackages},
+		{"Packages", readBdbPackages},
+	}
+
+	for _, dir := range dirs {
+		for _, backend := range backends {
+			path := filepath.Join(dir, backend.file)
+			if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+				return path, backend.reader, nil
+			}
+		}
+	}
+	return "", nil, errors.New("no rpm database found")
+}
+
+func hasRpmDatabase() bool {
+	_, _, err := findRpmDatabase(RpmDatabasePaths)
+	return err == nil
+}
+
+func readRpmDatabase() ([]rpmPackage, error) {
+	path, reader, err := findRpmDatabase(RpmDatabasePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := reader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	packages := make([]rpmPackage, 0, len(blobs))
+	for _, blob := range blobs {
+		pkg, err := parseRpmPackage(blob)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping broken rpm header in", path+":", err)
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Berkeley DB hash database layout (see dbinc/db_page.h)
+const (
+	bdbHashMagic          = 0x061561
+	bdbPageHeaderSize     = 26
+	bdbPageTypeHashUnsort = 2
+	bdbPageTypeOverflow   = 7
+	bdbPageTypeHash       = 13
+	bdbItemKeyData        = 1
+	bdbItemOffPage        = 3
+)
+
+type bdbFile struct {
+	file     *os.File
+	order    binary.ByteOrder
+	pageSize uint32
+}
+
+func (db *bdbFile) readPage(pageNo uint32) ([]byte, error) {
+	page := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(page, int64(pageNo)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("reading page %d: %v", pageNo, err)
+	}
+	return page, nil
+}
+
+// readOverflow collects the value stored in the overflow page chain starting
+// at pageNo.
+func (db *bdbFile) readOverflow(pageNo uint32, length uint32) ([]byte, error) {
+	value := make([]byte, 0, length)
+	visited := make(map[uint32]bool)
+
+	for pageNo != 0 {
+		if visited[pageNo] {
+			return nil, fmt.Errorf("overflow chain loops at page %d", pageNo)
+		}
+		visited[pageNo] = true
+
+		page, err := db.readPage(pageNo)
+		if err != nil {
+			return nil, err
+		}
+		if page[25] != bdbPageTypeOverflow {
+			return nil, fmt.Errorf("page %d is not an overflow page", pageNo)
+		}
+
+		pageNo = db.order.Uint32(page[16:20])
+		end := db.pageSize
+		if pageNo == 0 {
+			// the last page stores the length of its data in hf_offset
+			end = bdbPageHeaderSize + uint32(db.order.Uint16(page[22:24]))
+		}
+		if end > db.pageSize {
+			return nil, errors.New("overflow page data exceeds the page size")
+		}
+		value = append(value, page[bdbPageHeaderSize:end]...)
+	}
+
+	if uint32(len(value)) < length {
+		return nil, errors.New("overflow chain is shorter than the stored value")
+	}
+	return value[:length], nil
+}
+
+// readBdbPackages returns the values of all records of a Berkeley DB hash
+// database, i.e. the rpm headers of the legacy /var/lib/rpm/Packages.
+func readBdbPackages(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	meta := make([]byte, 512)
+	if _, err := file.ReadAt(meta, 0); err != nil {
+		return nil, fmt.Errorf("reading metadata page: %v", err)
+	}
+
+	db := bdbFile{file: file}
+	switch {
+	case binary.LittleEndian.Uint32(meta[12:16]) == bdbHashMagic:
+		db.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(meta[12:16]) == bdbHashMagic:
+		db.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a Berkeley DB hash database")
+	}
+	db.pageSize = db.order.Uint32(meta[20:24])
+	if db.pageSize < 512 || db.pageSize > 65536 {
+		return nil, fmt.Errorf("invalid page size %d", db.pageSize)
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pages := uint32(fi.Size() / int64(db.pageSize))
+
+	var blobs [][]byte
+	for pageNo := uint32(1); pageNo < pages; pageNo++ {
+		page, err := db.readPage(pageNo)
+		if err != nil {
+			return nil, err
+		}
+		if page[25] != bdbPageTypeHash && page[25] != bdbPageTypeHashUnsort {
+			continue
+		}
+
+		entries := int(db.order.Uint16(page[20:22]))
+		if bdbPageHeaderSize+2*entries > len(page) {
+			return nil, fmt.Errorf("page %d has too many entries", pageNo)
+		}
+		offsets := make([]uint32, entries)
+		for i := range offsets {
+			offsets[i] = uint32(db.order.Uint16(page[bdbPageHeaderSize+2*i:]))
+		}
+
+		// entries are stored as key/value pairs, the items themselves grow from
+		// the end of the page towards its beginning
+		for i := 1; i < entries; i += 2 {
+			offset := offsets[i]
+			if offset >= db.pageSize {
+				return nil, fmt.Errorf("page %d has an invalid item offset", pageNo)
+			}
+
+			switch page[offset] {
+			case bdbItemOffPage:
+				if offset+12 > db.pageSize {
+					return nil, fmt.Errorf("page %d has a truncated item", pageNo)
+				}
+				value, err := db.readOverflow(db.order.Uint32(page[offset+4:]),
+					db.order.Uint32(page[offset+8:]))
+				if err != nil {
+					return nil, err
+				}
+				blobs = append(blobs, value)
+			case bdbItemKeyData:
+				end := offsets[i-1]
+				if end <= offset || end > db.pageSize {
+					return nil, fmt.Errorf("page %d has an invalid item offset", pageNo)
+				}
+				value := page[offset+1 : end]
+				// skip the record number bookkeeping entry with the key 0
+				if len(value) >= 8 {
+					blobs = append(blobs, value)
+				}
+			}
+		}
+	}
+	return blobs, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// rpm's native NDB package database layout (see lib/backend/ndb/rpmpkg.c)
+const (
+	ndbHeaderMagic   = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic     = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic     = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbVersion       = 0
+	ndbSlotPageSize  = 4096
+	ndbSlotSize      = 16
+	ndbBlockSize     = 16
+	ndbHeaderSize    = 32
+	ndbBlobHeadSize  = 16
+	ndbMaxSlotPages  = 2048
+	ndbMaxBlobLength = rpmHeaderMaxData
+)
+
+// readNdbPackages returns the rpm headers stored in an NDB Packages.db.
+func readNdbPackages(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, ndbHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != ndbHeaderMagic {
+		return nil, errors.New("not an NDB package database")
+	}
+	if binary.LittleEndian.Uint32(header[4:8]) != ndbVersion {
+		return nil, errors.New("unsupported NDB version")
+	}
+	slotPages := binary.LittleEndian.Uint32(header[12:16])
+	if slotPages == 0 || slotPages > ndbMaxSlotPages {
+		return nil, fmt.Errorf("invalid number of slot pages %d", slotPages)
+	}
+
+	// the database header occupies the space of the first two slots
+	slots := make([]byte, slotPages*ndbSlotPageSize-ndbHeaderSize)
+	if _, err := file.ReadAt(slots, ndbHeaderSize); err != nil {
+		return nil, fmt.Errorf("reading slots: %v", err)
+	}
+
+	var blobs [][]byte
+	for offset := 0; offset+ndbSlotSize <= len(slots); offset += ndbSlotSize {
+		slot := slots[offset : offset+ndbSlotSize]
+		pkgIndex := binary.LittleEndian.Uint32(slot[4:8])
+		if binary.LittleEndian.Uint32(slot[0:4]) != ndbSlotMagic || pkgIndex == 0 {
+			continue
+		}
+		blkOffset := int64(binary.LittleEndian.Uint32(slot[8:12])) * ndbBlockSize
+
+		blobHeader := make([]byte, ndbBlobHeadSize)
+		if _, err := file.ReadAt(blobHeader, blkOffset); err != nil {
+			return nil, fmt.Errorf("reading blob of package %d: %v", pkgIndex, err)
+		}
+		if binary.LittleEndian.Uint32(blobHeader[0:4]) != ndbBlobMagic ||
+			binary.LittleEndian.Uint32(blobHeader[4:8]) != pkgIndex {
+			return nil, fmt.Errorf("corrupt blob of package %d", pkgIndex)
+		}
+		blobLength := binary.LittleEndian.Uint32(blobHeader[12:16])
+		if blobLength > ndbMaxBlobLength {
+			return nil, fmt.Errorf("blob of package %d is too large", pkgIndex)
+		}
+
+		blob := make([]byte, blobLength)
+		if _, err := file.ReadAt(blob, blkOffset+ndbBlobHeadSize); err != nil {
+			return nil, fmt.Errorf("reading blob of package %d: %v", pkgIndex, err)
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, nil
+}
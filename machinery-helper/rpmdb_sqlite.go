@@ -0,0 +1,399 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// A minimal read-only reader for the sqlite file format
+// (https://www.sqlite.org/fileformat.html) which is just capable enough to
+// dump the rowid tables of the rpmdb.sqlite database.
+const (
+	sqliteHeaderString    = "SQLite format 3\x00"
+	sqliteHeaderSize      = 100
+	sqlitePageInteriorTbl = 0x05
+	sqlitePageLeafTbl     = 0x0d
+	sqliteWalMagicLE      = 0x377f0682
+	sqliteWalMagicBE      = 0x377f0683
+	sqliteWalHeaderSize   = 32
+	sqliteWalFrameHdrSize = 24
+	sqliteMaxTreeDepth    = 64
+)
+
+type sqliteFile struct {
+	file       *os.File
+	pageSize   uint32
+	usableSize uint32
+	pageCount  uint32
+	// walFrames maps page numbers to the offset of their latest committed
+	// version in the write-ahead log
+	walFrames map[uint32]int64
+	wal       []byte
+}
+
+func openSqlite(path string) (*sqliteFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, sqliteHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if string(header[0:16]) != sqliteHeaderString {
+		file.Close()
+		return nil, errors.New("not an sqlite database")
+	}
+
+	db := &sqliteFile{file: file}
+	db.pageSize = uint32(binary.BigEndian.Uint16(header[16:18]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	if db.pageSize < 512 || db.pageSize&(db.pageSize-1) != 0 {
+		file.Close()
+		return nil, fmt.Errorf("invalid page size %d", db.pageSize)
+	}
+	db.usableSize = db.pageSize - uint32(header[20])
+	// the in-header database size is only valid if written by a recent sqlite
+	if string(header[24:28]) == string(header[92:96]) {
+		db.pageCount = binary.BigEndian.Uint32(header[28:32])
+	}
+
+	if err := db.loadWal(path + "-wal"); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadWal indexes the committed frames of the write-ahead log, pages found
+// there supersede the ones in the database file.
+func (db *sqliteFile) loadWal(path string) error {
+	wal, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || len(wal) < sqliteWalHeaderSize {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	magic := binary.BigEndian.Uint32(wal[0:4])
+	if magic != sqliteWalMagicLE && magic != sqliteWalMagicBE {
+		return nil
+	}
+	if binary.BigEndian.Uint32(wal[8:12]) != db.pageSize {
+		return errors.New("page size of the write-ahead log does not match")
+	}
+	salt := wal[16:24]
+
+	db.wal = wal
+	db.walFrames = make(map[uint32]int64)
+	pending := make(map[uint32]int64)
+	frameSize := int64(sqliteWalFrameHdrSize + db.pageSize)
+	for offset := int64(sqliteWalHeaderSize); offset+frameSize <= int64(len(wal)); offset += frameSize {
+		frame := wal[offset : offset+sqliteWalFrameHdrSize]
+		if string(frame[8:16]) != string(salt) {
+			break
+		}
+		pending[binary.BigEndian.Uint32(frame[0:4])] = offset + sqliteWalFrameHdrSize
+
+		// a non-zero database size marks the commit frame of a transaction
+		if size := binary.BigEndian.Uint32(frame[4:8]); size != 0 {
+			for pageNo, pageOffset := range pending {
+				db.walFrames[pageNo] = pageOffset
+			}
+			pending = make(map[uint32]int64)
+			db.pageCount = size
+		}
+	}
+	return nil
+}
+
+func (db *sqliteFile) Close() error {
+	return db.file.Close()
+}
+
+func (db *sqliteFile) readPage(pageNo uint32) ([]byte, error) {
+	if pageNo == 0 || (db.pageCount > 0 && pageNo > db.pageCount) {
+		return nil, fmt.Errorf("page %d is out of range", pageNo)
+	}
+	if offset, ok := db.walFrames[pageNo]; ok {
+		return db.wal[offset : offset+int64(db.pageSize)], nil
+	}
+
+	page := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(page, int64(pageNo-1)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("reading page %d: %v", pageNo, err)
+	}
+	return page, nil
+}
+
+func sqliteVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return value<<8 | uint64(data[i]), 9
+		}
+		value = value<<7 | uint64(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// payload returns the complete payload of a table leaf cell, following the
+// overflow pages if needed.
+func (db *sqliteFile) payload(cell []byte) ([]byte, error) {
+	size, n := sqliteVarint(cell)
+	if n == 0 {
+		return nil, errors.New("invalid payload size")
+	}
+	cell = cell[n:]
+	if _, n = sqliteVarint(cell); n == 0 {
+		return nil, errors.New("invalid rowid")
+	}
+	cell = cell[n:]
+
+	usable := uint64(db.usableSize)
+	maxLocal := usable - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (usable-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if uint64(len(cell)) < local {
+		return nil, errors.New("cell exceeds the page")
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, cell[:local]...)
+	if local == size {
+		return payload, nil
+	}
+	if uint64(len(cell)) < local+4 {
+		return nil, errors.New("missing overflow page")
+	}
+
+	pageNo := binary.BigEndian.Uint32(cell[local:])
+	for uint64(len(payload)) < size {
+		if pageNo == 0 {
+			return nil, errors.New("overflow chain is too short")
+		}
+		page, err := db.readPage(pageNo)
+		if err != nil {
+			return nil, err
+		}
+		chunk := page[4:db.usableSize]
+		if remaining := size - uint64(len(payload)); uint64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		pageNo = binary.BigEndian.Uint32(page[0:4])
+	}
+	return payload, nil
+}
+
+// walkTable calls fn with the payload of every row of the table b-tree
+// starting at rootPage.
+func (db *sqliteFile) walkTable(rootPage uint32, fn func([]byte) error) error {
+	return db.walkTablePage(rootPage, 0, fn)
+}
+
+func (db *sqliteFile) walkTablePage(pageNo uint32, depth int, fn func([]byte) error) error {
+	if depth > sqliteMaxTreeDepth {
+		return errors.New("b-tree is too deep")
+	}
+	page, err := db.readPage(pageNo)
+	if err != nil {
+		return err
+	}
+
+	headerStart := 0
+	if pageNo == 1 {
+		headerStart = sqliteHeaderSize
+	}
+	header := page[headerStart:]
+	pageType := header[0]
+	cells := int(binary.BigEndian.Uint16(header[3:5]))
+
+	headerSize := 8
+	if pageType == sqlitePageInteriorTbl {
+		headerSize = 12
+	} else if pageType != sqlitePageLeafTbl {
+		return fmt.Errorf("page %d is not a table b-tree page", pageNo)
+	}
+	if headerStart+headerSize+2*cells > len(page) {
+		return fmt.Errorf("page %d has too many cells", pageNo)
+	}
+
+	for i := 0; i < cells; i++ {
+		offset := int(binary.BigEndian.Uint16(header[headerSize+2*i:]))
+		if offset >= len(page) {
+			return fmt.Errorf("page %d has an invalid cell offset", pageNo)
+		}
+		cell := page[offset:]
+
+		if pageType == sqlitePageInteriorTbl {
+			if len(cell) < 4 {
+				return fmt.Errorf("page %d has a truncated cell", pageNo)
+			}
+			if err := db.walkTablePage(binary.BigEndian.Uint32(cell), depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		payload, err := db.payload(cell)
+		if err != nil {
+			return fmt.Errorf("page %d: %v", pageNo, err)
+		}
+		if err := fn(payload); err != nil {
+			return err
+		}
+	}
+
+	if pageType == sqlitePageInteriorTbl {
+		return db.walkTablePage(binary.BigEndian.Uint32(header[8:12]), depth+1, fn)
+	}
+	return nil
+}
+
+// sqliteRecord decodes a record into its column values which are either nil,
+// int64, float64 (as raw bits), string or []byte.
+func sqliteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, errors.New("invalid record header")
+	}
+
+	var values []interface{}
+	header := payload[n:headerSize]
+	body := payload[headerSize:]
+	for len(header) > 0 {
+		serialType, n := sqliteVarint(header)
+		if n == 0 {
+			return nil, errors.New("invalid serial type")
+		}
+		header = header[n:]
+
+		var length uint64
+		switch {
+		case serialType >= 12:
+			length = (serialType - 12) / 2
+		case serialType >= 1 && serialType <= 4:
+			length = serialType
+		case serialType == 5:
+			length = 6
+		case serialType == 6 || serialType == 7:
+			length = 8
+		}
+		if length > uint64(len(body)) {
+			return nil, errors.New("record body is truncated")
+		}
+		data := body[:length]
+		body = body[length:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType >= 1 && serialType <= 6:
+			value := int64(int8(data[0]))
+			for _, b := range data[1:] {
+				value = value<<8 | int64(b)
+			}
+			values = append(values, value)
+		case serialType == 7:
+			values = append(values, binary.BigEndian.Uint64(data))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, data)
+		case serialType >= 13:
+			values = append(values, string(data))
+		default:
+			return nil, fmt.Errorf("unsupported serial type %d", serialType)
+		}
+	}
+	return values, nil
+}
+
+// tableRootPage looks up the root page of a table in the sqlite_master table.
+func (db *sqliteFile) tableRootPage(name string) (uint32, error) {
+	var rootPage uint32
+	err := db.walkTable(1, func(payload []byte) error {
+		values, err := sqliteRecord(payload)
+		if err != nil {
+			return err
+		}
+		if len(values) >= 4 && values[0] == "table" && values[1] == name {
+			if page, ok := values[3].(int64); ok {
+				rootPage = uint32(page)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rootPage == 0 {
+		return 0, fmt.Errorf("table %s not found", name)
+	}
+	return rootPage, nil
+}
+
+// readSqlitePackages returns the rpm headers stored in rpmdb.sqlite.
+func readSqlitePackages(path string) ([][]byte, error) {
+	db, err := openSqlite(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rootPage, err := db.tableRootPage("Packages")
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs [][]byte
+	err = db.walkTable(rootPage, func(payload []byte) error {
+		values, err := sqliteRecord(payload)
+		if err != nil {
+			return err
+		}
+		// Packages(hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)
+		if len(values) >= 2 {
+			if blob, ok := values[1].([]byte); ok {
+				blobs = append(blobs, blob)
+			}
+		}
+		return nil
+	})
+	return blobs, err
+}
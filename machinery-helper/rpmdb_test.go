@@ -0,0 +1,267 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testRpmTag struct {
+	tag   uint32
+	value interface{}
+}
+
+// buildRpmHeader creates an rpm header blob as it is stored in the database
+func buildRpmHeader(tags []testRpmTag) []byte {
+	var index, data bytes.Buffer
+
+	for _, tag := range tags {
+		var tagType, count uint32
+		offset := uint32(data.Len())
+
+		switch value := tag.value.(type) {
+		case string:
+			tagType, count = rpmTypeString, 1
+			data.WriteString(value + "\x00")
+		case []string:
+			tagType, count = rpmTypeStringArray, uint32(len(value))
+			for _, s := range value {
+				data.WriteString(s + "\x00")
+			}
+		case []uint16:
+			tagType, count = rpmTypeInt16, uint32(len(value))
+			binary.Write(&data, binary.BigEndian, value)
+		case []int32:
+			tagType, count = rpmTypeInt32, uint32(len(value))
+			binary.Write(&data, binary.BigEndian, value)
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{tag.tag, tagType, offset, count})
+	}
+
+	var blob bytes.Buffer
+	binary.Write(&blob, binary.BigEndian, []uint32{uint32(len(tags)), uint32(data.Len())})
+	blob.Write(index.Bytes())
+	blob.Write(data.Bytes())
+	return blob.Bytes()
+}
+
+func testRpmPackageBlob(name string) []byte {
+	return buildRpmHeader([]testRpmTag{
+		{rpmTagName, name},
+		{rpmTagDirNames, []string{"/etc/", "/usr/lib64/"}},
+		{rpmTagBaseNames, []string{name + ".conf", "lib" + name + ".so", name}},
+		{rpmTagDirIndexes, []int32{0, 1, 1}},
+		{rpmTagFileModes, []uint16{0100644, 0120777, 040755}},
+		{rpmTagFileLinkTos, []string{"", "lib" + name + ".so.1", ""}},
+		{rpmTagFileFlags, []int32{rpmFileConfig, 0, 0}},
+	})
+}
+
+func TestParseRpmPackage(t *testing.T) {
+	pkg, err := parseRpmPackage(testRpmPackageBlob("foo"))
+	if err != nil {
+		t.Fatalf("parseRpmPackage() failed: %v", err)
+	}
+
+	want := rpmPackage{
+		Name: "foo",
+		Files: []rpmFile{
+			{Name: "/etc/foo.conf", Mode: 0100644, Flags: rpmFileConfig},
+			{Name: "/usr/lib64/libfoo.so", Mode: 0120777, LinkTarget: "libfoo.so.1"},
+			{Name: "/usr/lib64/foo", Mode: 040755},
+		},
+	}
+	if !reflect.DeepEqual(pkg, want) {
+		t.Errorf("parseRpmPackage() = '%v', want '%v'", pkg, want)
+	}
+}
+
+func TestParseRpmPackageBrokenHeaders(t *testing.T) {
+	blob := testRpmPackageBlob("foo")
+
+	if _, err := parseRpmPackage(blob[:len(blob)-10]); err == nil {
+		t.Errorf("parseRpmPackage() of a truncated header should fail")
+	}
+
+	broken := buildRpmHeader([]testRpmTag{
+		{rpmTagDirNames, []string{"/etc/"}},
+		{rpmTagBaseNames, []string{"foo.conf"}},
+		{rpmTagDirIndexes, []int32{3}},
+	})
+	if _, err := parseRpmPackage(broken); err == nil {
+		t.Errorf("parseRpmPackage() with invalid dir indexes should fail")
+	}
+}
+
+func TestReadNdbPackages(t *testing.T) {
+	blobs := [][]byte{testRpmPackageBlob("foo"), testRpmPackageBlob("bar")}
+
+	db := make([]byte, ndbSlotPageSize)
+	binary.LittleEndian.PutUint32(db[0:], ndbHeaderMagic)
+	binary.LittleEndian.PutUint32(db[12:], 1)
+	for i, blob := range blobs {
+		blkOffset := uint32(len(db) / ndbBlockSize)
+		slot := db[ndbHeaderSize+ndbSlotSize*i:]
+		binary.LittleEndian.PutUint32(slot[0:], ndbSlotMagic)
+		binary.LittleEndian.PutUint32(slot[4:], uint32(i+1))
+		binary.LittleEndian.PutUint32(slot[8:], blkOffset)
+
+		blobHeader := make([]byte, ndbBlobHeadSize)
+		binary.LittleEndian.PutUint32(blobHeader[0:], ndbBlobMagic)
+		binary.LittleEndian.PutUint32(blobHeader[4:], uint32(i+1))
+		binary.LittleEndian.PutUint32(blobHeader[12:], uint32(len(blob)))
+		db = append(db, blobHeader...)
+		db = append(db, blob...)
+		for len(db)%ndbBlockSize != 0 {
+			db = append(db, 0)
+		}
+	}
+
+	path := writeTestDatabase(t, "Packages.db", db)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	actual, err := readNdbPackages(path)
+	if err != nil {
+		t.Fatalf("readNdbPackages() failed: %v", err)
+	}
+	if !reflect.DeepEqual(actual, blobs) {
+		t.Errorf("readNdbPackages() returned %d blobs, want %d", len(actual), len(blobs))
+	}
+}
+
+func TestReadBdbPackages(t *testing.T) {
+	pageSize := 512
+	inline := testRpmPackageBlob("foo")
+	overflow := testRpmPackageBlob("barbazbarbazbarbaz")
+	overflow = append(overflow, bytes.Repeat([]byte{0}, 600)...)
+
+	db := make([]byte, 4*pageSize)
+	meta := db[0:pageSize]
+	binary.LittleEndian.PutUint32(meta[12:], bdbHashMagic)
+	binary.LittleEndian.PutUint32(meta[20:], uint32(pageSize))
+
+	// page 1 holds one inline and one off-page record
+	page := db[pageSize : 2*pageSize]
+	page[25] = bdbPageTypeHash
+	binary.LittleEndian.PutUint16(page[20:], 4)
+	offsets := make([]int, 4)
+	offsets[0] = pageSize - 5
+	page[offsets[0]] = bdbItemKeyData
+	offsets[1] = offsets[0] - len(inline) - 1
+	page[offsets[1]] = bdbItemKeyData
+	copy(page[offsets[1]+1:], inline)
+	offsets[2] = offsets[1] - 5
+	page[offsets[2]] = bdbItemKeyData
+	offsets[3] = offsets[2] - 12
+	page[offsets[3]] = bdbItemOffPage
+	binary.LittleEndian.PutUint32(page[offsets[3]+4:], 2)
+	binary.LittleEndian.PutUint32(page[offsets[3]+8:], uint32(len(overflow)))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint16(page[bdbPageHeaderSize+2*i:], uint16(offset))
+	}
+
+	// pages 2 and 3 hold the overflow chain of the second record
+	first := db[2*pageSize : 3*pageSize]
+	first[25] = bdbPageTypeOverflow
+	binary.LittleEndian.PutUint32(first[16:], 3)
+	n := copy(first[bdbPageHeaderSize:], overflow)
+	last := db[3*pageSize : 4*pageSize]
+	last[25] = bdbPageTypeOverflow
+	binary.LittleEndian.PutUint16(last[22:], uint16(len(overflow)-n))
+	copy(last[bdbPageHeaderSize:], overflow[n:])
+
+	path := writeTestDatabase(t, "Packages", db)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	actual, err := readBdbPackages(path)
+	if err != nil {
+		t.Fatalf("readBdbPackages() failed: %v", err)
+	}
+	want := [][]byte{inline, overflow}
+	if !reflect.DeepEqual(actual, want) {
+		t.Errorf("readBdbPackages() = '%v', want '%v'", actual, want)
+	}
+}
+
+func TestReadSqlitePackages(t *testing.T) {
+	blobs, err := readSqlitePackages("fixtures/rpmdb/rpmdb.sqlite")
+	if err != nil {
+		t.Fatalf("readSqlitePackages() failed: %v", err)
+	}
+
+	if len(blobs) != 41 {
+		t.Fatalf("readSqlitePackages() returned %d blobs, want 41", len(blobs))
+	}
+	for _, blob := range blobs {
+		if _, err := parseRpmPackage(blob); err != nil {
+			t.Errorf("parseRpmPackage() of the sqlite blobs failed: %v", err)
+		}
+	}
+}
+
+func TestGetManagedFilesRpm(t *testing.T) {
+	defer func(original []string) { RpmDatabasePaths = original }(RpmDatabasePaths)
+	RpmDatabasePaths = []string{"fixtures/rpmdb"}
+
+	files, dirs, err := getManagedFilesRpm()
+	if err != nil {
+		t.Fatalf("getManagedFilesRpm() failed: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"/usr/bin/aaa":         "",
+		"/usr/lib64/libaaa.so": "libaaa.so.1",
+		"/etc/aaa.conf":        "",
+	}
+	for file, target := range wantFiles {
+		if actual, ok := files[file]; !ok || actual != target {
+			t.Errorf("getManagedFilesRpm() files['%v'] = '%v', want '%v'", file, actual, target)
+		}
+	}
+	if _, ok := files["/usr/share/pkg39/file-194"]; !ok {
+		t.Errorf("getManagedFilesRpm() is missing files of the last package")
+	}
+	if len(files) != 3+5*39*40/2 {
+		t.Errorf("getManagedFilesRpm() returned %d files, want %d", len(files), 3+5*39*40/2)
+	}
+
+	wantDirs := map[string]bool{"/usr": false, "/usr/share": false, "/usr/share/aaa": true}
+	for dir, explicit := range wantDirs {
+		if actual, ok := dirs[dir]; !ok || actual != explicit {
+			t.Errorf("getManagedFilesRpm() dirs['%v'] = '%v', want '%v'", dir, actual, explicit)
+		}
+	}
+}
+
+func writeTestDatabase(t *testing.T, name string, content []byte) string {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
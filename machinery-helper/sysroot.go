@@ -0,0 +1,71 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// mountsBelow returns the mounts inside dir with their mount points relative
+// to dir. dir itself is not included.
+func mountsBelow(mounts []mountInfo, dir string) []mountInfo {
+	below := []mountInfo{}
+	for _, mount := range mounts {
+		if dir == "/" {
+			below = append(below, mount)
+		} else if strings.HasPrefix(mount.MountPoint, dir+"/") {
+			mount.MountPoint = strings.TrimPrefix(mount.MountPoint, dir)
+			below = append(below, mount)
+		}
+	}
+	return below
+}
+
+// enterSysroot changes the root directory of the process to dir, so the
+// package database is read from there, the walk starts there and the paths
+// are reported relative to it. The mounts inside dir are taken from the
+// process mounts before, because /proc is usually not mounted in an image.
+func enterSysroot(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("sysroot '%s' is not a directory", dir)
+	}
+
+	mounts := mountsBelow(readMounts(), dir)
+	if err := syscall.Chroot(dir); err != nil {
+		return fmt.Errorf("changing the root directory to '%s' failed: %v", dir, err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	sysrootMounts = mounts
+	return nil
+}
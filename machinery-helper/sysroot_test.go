@@ -0,0 +1,61 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMountsBelow(t *testing.T) {
+	mounts := []mountInfo{
+		{ID: 1, MountPoint: "/", FSType: "ext4"},
+		{ID: 2, MountPoint: "/mnt/image", FSType: "ext4"},
+		{ID: 3, MountPoint: "/mnt/image/boot", FSType: "vfat"},
+		{ID: 4, MountPoint: "/mnt/image/proc", FSType: "proc"},
+		{ID: 5, MountPoint: "/mnt/image/home/nfs", FSType: "nfs"},
+		{ID: 6, MountPoint: "/mnt/image-other/tmp", FSType: "tmpfs"},
+	}
+
+	want := []mountInfo{
+		{ID: 3, MountPoint: "/boot", FSType: "vfat"},
+		{ID: 4, MountPoint: "/proc", FSType: "proc"},
+		{ID: 5, MountPoint: "/home/nfs", FSType: "nfs"},
+	}
+	if actual := mountsBelow(mounts, "/mnt/image"); !reflect.DeepEqual(actual, want) {
+		t.Errorf("mountsBelow() = '%v', want '%v'", actual, want)
+	}
+	if actual := mountsBelow(mounts, "/"); !reflect.DeepEqual(actual, mounts) {
+		t.Errorf("mountsBelow() of '/' = '%v', want '%v'", actual, mounts)
+	}
+}
+
+func TestSysrootMounts(t *testing.T) {
+	sysrootMounts = []mountInfo{
+		{MountPoint: "/home/nfs", FSType: "nfs"},
+		{MountPoint: "/proc", FSType: "proc"},
+	}
+	defer func() { sysrootMounts = nil }()
+
+	if actual := RemoteMounts(); !reflect.DeepEqual(actual, []string{"/home/nfs"}) {
+		t.Errorf("RemoteMounts() = '%v', want '[/home/nfs]'", actual)
+	}
+	if actual := SpecialMounts(); !reflect.DeepEqual(actual, []string{"/proc"}) {
+		t.Errorf("SpecialMounts() = '%v', want '[/proc]'", actual)
+	}
+}
@@ -25,10 +25,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"os/user"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -63,23 +60,26 @@ func addPath(path string, info os.FileInfo, err error) error {
 			}
 		}
 		header, err := tar.FileInfoHeader(stat, linkTarget)
-		header.Name = strings.TrimLeft(path, "/")
 		if err != nil {
 			return err
 		}
+		header.Name = strings.TrimLeft(path, "/")
 
-		username, err := user.LookupId(strconv.Itoa(header.Uid))
-		if err != nil {
-			return err
-		}
-		header.Uname = username.Username
+		header.Uname = lookupUserName(uint32(header.Uid))
+		header.Gname = lookupGroupName(uint32(header.Gid))
 
-		groupname, err := exec.Command("bash", "-c",
-			fmt.Sprintf("getent group %d | cut -d: -f1", header.Gid)).Output()
+		xattrs, err := readXattrs(path)
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, "Could not read the extended attributes of", path+":", err)
+		}
+		// Xattrs are written as SCHILY.xattr PAX records, PAXRecords would
+		// need Go 1.10
+		for name, value := range xattrs {
+			if header.Xattrs == nil {
+				header.Xattrs = make(map[string]string)
+			}
+			header.Xattrs[name] = string(value)
 		}
-		header.Gname = strings.TrimSpace(string(groupname))
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return err
@@ -0,0 +1,67 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAddPathOwnerNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwd := filepath.Join(dir, "passwd")
+	ioutil.WriteFile(passwd, []byte(fmt.Sprintf("machinery:x:%d:0::/:/bin/sh\n", os.Getuid())), 0644)
+	group := filepath.Join(dir, "group")
+	ioutil.WriteFile(group, []byte{}, 0644)
+	noNSS := func(string) (string, error) { return "", errors.New("not found") }
+	defer func(original *idNameCache) { userNames = original }(userNames)
+	defer func(original *idNameCache) { groupNames = original }(groupNames)
+	userNames = newIDNameCache(&passwd, noNSS)
+	groupNames = newIDNameCache(&group, noNSS)
+
+	var archive bytes.Buffer
+	defer func(original *tar.Writer) { tarWriter = original }(tarWriter)
+	tarWriter = tar.NewWriter(&archive)
+	if err := filepath.Walk(passwd, addPath); err != nil {
+		t.Fatalf("addPath() failed: %v", err)
+	}
+	tarWriter.Close()
+
+	header, err := tar.NewReader(&archive).Next()
+	if err != nil {
+		t.Fatalf("reading the archive failed: %v", err)
+	}
+	if header.Uname != "machinery" {
+		t.Errorf("header.Uname = '%v', want 'machinery'", header.Uname)
+	}
+	if want := strconv.Itoa(os.Getgid()); header.Gname != want {
+		t.Errorf("header.Gname = '%v', want the numeric gid '%v'", header.Gname, want)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// walkOptions are the options selecting the trees which are walked. They are
+// shared by the inspection and the subcommands which walk the whole system.
+type walkOptions struct {
+	roots             stringArrayFlag
+	excludes          stringArrayFlag
+	excludeFrom       *string
+	sysroot           *string
+	fileSystemClasses *string
+	oneFileSystem     *bool
+	includeSnapshots  *bool
+	jobs              *int
+
+	// Roots are the normalized roots and Excludes are the patterns of
+	// --exclude and --exclude-from once the options are parsed
+	Roots    []string
+	Excludes []string
+}
+
+// addWalkFlags defines the walk options in flags
+func addWalkFlags(flags *flag.FlagSet) *walkOptions {
+	o := &walkOptions{}
+	flags.Var(&o.roots, "root", "only inspect the tree at the given absolute path, can be given multiple times")
+	flags.Var(&o.excludes, "exclude",
+		"gitignore-style pattern of paths which are not inspected, can be given multiple times")
+	o.excludeFrom = flags.String("exclude-from", "", "file with one exclude pattern per line")
+	o.sysroot = flags.String("sysroot", "",
+		"inspect the system in the given directory, e.g. a mounted image, instead of the running one")
+	o.fileSystemClasses = flags.String("filesystem-classes", "",
+		"file with additional file system types or statfs magic numbers classified as 'local', 'remote' or 'special'")
+	o.oneFileSystem = flags.Bool("one-file-system", false,
+		"does not walk into file systems other than the ones of the roots and the local mounts")
+	o.includeSnapshots = flags.Bool("include-snapshots", false,
+		"inspects btrfs snapshot subvolumes like the ones in /.snapshots as well")
+	o.jobs = flags.Int("jobs", runtime.NumCPU(), "number of directories which are walked concurrently")
+	return o
+}
+
+// parse normalizes the roots and sets up IgnoreRules and the file system
+// classes. The files are read before entering the sysroot.
+func (o *walkOptions) parse() error {
+	roots, err := normalizeRoots(o.roots)
+	if err != nil {
+		return err
+	}
+	o.Roots = roots
+
+	o.Excludes = []string(o.excludes)
+	if *o.excludeFrom != "" {
+		patterns, err := readExcludeFile(*o.excludeFrom)
+		if err != nil {
+			return err
+		}
+		o.Excludes = append(o.Excludes, patterns...)
+	}
+	if *o.fileSystemClasses != "" {
+		if err := readFileSystemClasses(*o.fileSystemClasses); err != nil {
+			return err
+		}
+	}
+	IgnoreRules, err = newIgnoreRules(o.Excludes)
+	if err != nil {
+		return fmt.Errorf("invalid exclude pattern: %v", err)
+	}
+	return nil
+}
+
+// enterSystem enters the sysroot if there is one and sets up IgnoreList. The
+// helper itself and the ignored files are only skipped on the running system.
+func (o *walkOptions) enterSystem(ignoredFiles ...string) error {
+	if *o.sysroot != "" {
+		if err := enterSysroot(*o.sysroot); err != nil {
+			return err
+		}
+		IgnoreList = newIgnoreList()
+		return nil
+	}
+
+	thisBinary, _ := filepath.Abs(os.Args[0])
+	IgnoreList = newIgnoreList(append(ignoredFiles, thisBinary)...)
+	return nil
+}
+
+// newWalker returns a walker of the entered system which skips the paths
+// excluded by the options
+func (o *walkOptions) newWalker(managedFiles map[string]string, managedDirs map[string]bool) *unmanagedFilesWalker {
+	walker := newUnmanagedFilesWalker(managedFiles, managedDirs, IgnoreList, *o.jobs)
+	walker.IgnoreRules = IgnoreRules
+	walker.IncludeSnapshots = *o.includeSnapshots
+	walker.BtrfsMounts = BtrfsMounts()
+	if *o.oneFileSystem {
+		walker.Devices = fileSystemDevices(append(LocalMounts(), o.Roots...))
+	}
+	return walker
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestWalkOptionsParse(t *testing.T) {
+	defer func(original ignoreRules) { IgnoreRules = original }(IgnoreRules)
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	options := addWalkFlags(flags)
+	flags.Parse([]string{"--root=/srv/", "--root=/srv/www", "--root=/etc", "--exclude=*.pyc"})
+	if err := options.parse(); err != nil {
+		t.Fatalf("parse() failed: %v", err)
+	}
+
+	if expected := []string{"/etc", "/srv"}; !reflect.DeepEqual(options.Roots, expected) {
+		t.Errorf("options.Roots = '%v', want '%v'", options.Roots, expected)
+	}
+	if !IgnoreRules.ignores("/srv/foo.pyc", false) {
+		t.Errorf("IgnoreRules should ignore '/srv/foo.pyc'")
+	}
+
+	flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	options = addWalkFlags(flags)
+	flags.Parse([]string{"--root=srv"})
+	if err := options.parse(); err == nil {
+		t.Errorf("parse() with a relative root should fail")
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unicode/utf8"
+)
+
+// dirStats holds the size and the number of files and directories of an
+// unmanaged directory tree. The fields are updated atomically while the tree
+// is walked, so they have to stay at the start of the struct to be 64-bit
+// aligned on 32-bit platforms.
+type dirStats struct {
+	Size  int64
+	Files int64
+	Dirs  int64
+
+	mutex     sync.Mutex
+	hardlinks map[fileID]bool
+}
+
+// A fileID identifies an inode on the system
+type fileID struct {
+	Dev   uint64
+	Inode uint64
+}
+
+// countedBefore returns true if f is a hard link to a file whose size was
+// already added to the stats
+func (stats *dirStats) countedBefore(f os.FileInfo) bool {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return false
+	}
+
+	id := fileID{Dev: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	if stats.hardlinks == nil {
+		stats.hardlinks = make(map[fileID]bool)
+	}
+	if stats.hardlinks[id] {
+		return true
+	}
+	stats.hardlinks[id] = true
+	return false
+}
+
+// An unmanagedFilesWalker finds the unmanaged files below a directory. The
+// managed directories are walked concurrently by up to Jobs goroutines.
+type unmanagedFilesWalker struct {
+	ManagedFiles map[string]string
+	ManagedDirs  map[string]bool
+	IgnoreList   map[string]bool
+	// IgnoreRules are the patterns of further paths which are not walked
+	IgnoreRules ignoreRules
+	// Devices restricts the walk to the file systems with the given device
+	// numbers if it is set
+	Devices map[uint64]bool
+	// IncludeSnapshots walks btrfs snapshot subvolumes as well, which are
+	// skipped by default as they are copies of the system
+	IncludeSnapshots bool
+	// BtrfsMounts maps the mount points of btrfs subvolumes to the mounted
+	// subvolume. Mounted snapshots are walked.
+	BtrfsMounts map[string]string
+	// WithDirStats enables computing the dir stats of the unmanaged
+	// directories during the walk
+	WithDirStats bool
+	// IncludeManaged reports the managed files and directories as well and
+	// walks into the unmanaged directories instead of reporting them as a
+	// whole, Found has to tell them apart then
+	IncludeManaged bool
+	// Found is called concurrently for every unmanaged file as soon as it
+	// and its dir stats are complete. Directories end with a "/". If Found
+	// is nil the files are collected in UnmanagedFiles and DirStats.
+	Found func(name string, fileType string, stats *dirStats)
+
+	// UnmanagedFiles maps the unmanaged files to their type
+	UnmanagedFiles map[string]string
+	// DirStats maps the unmanaged directories to their stats
+	DirStats map[string]*dirStats
+
+	// Baseline holds the directory states of a previous inspection, the
+	// directories which did not change since are not read again
+	Baseline *baseline
+	// DirStates collects the states of the walked directories for the next
+	// baseline if it is set
+	DirStates map[string]dirState
+
+	workers    chan struct{}
+	wg         sync.WaitGroup
+	mutex      sync.Mutex
+	subvolumes map[string]bool
+
+	managedIndexOnce sync.Once
+	managedDigests   map[string]string
+	managedSubdirs   map[string][]string
+}
+
+func newUnmanagedFilesWalker(managedFiles map[string]string, managedDirs map[string]bool,
+	ignoreList map[string]bool, jobs int) *unmanagedFilesWalker {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	return &unmanagedFilesWalker{
+		ManagedFiles:   managedFiles,
+		ManagedDirs:    managedDirs,
+		IgnoreList:     ignoreList,
+		UnmanagedFiles: make(map[string]string),
+		DirStats:       make(map[string]*dirStats),
+		// the calling goroutine is one of the workers
+		workers: make(chan struct{}, jobs-1),
+	}
+}
+
+// Walk finds the unmanaged files below dir, which has to end with a "/", and
+// returns when the whole tree has been walked.
+func (w *unmanagedFilesWalker) Walk(dir string) {
+	w.findUnmanagedFiles(dir)
+	w.wg.Wait()
+}
+
+// WalkRoot finds the unmanaged files in the tree at root like Walk, but root
+// itself is reported if it is not managed. Roots inside ignored trees are
+// skipped.
+func (w *unmanagedFilesWalker) WalkRoot(root string) {
+	root = filepath.Clean(root)
+	w.findSubvolumes(filepath.Dir(root))
+	if root == "/" {
+		w.Walk("/")
+		return
+	}
+	for parent := filepath.Dir(root); parent != "/"; parent = filepath.Dir(parent) {
+		if w.ignores(parent, true) {
+			return
+		}
+	}
+
+	fi, err := os.Lstat(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, root, "was not accessible. Skipping.", err)
+		return
+	}
+	if fi.IsDir() && !w.IncludeManaged && hasManagedDirs(root, w.ManagedDirs) && !w.ignores(root, true) {
+		// the managed directories below root are walked even if root is
+		// not listed as managed itself
+		w.findUnmanagedFiles(root + "/")
+	} else {
+		w.visit(root, fi)
+	}
+	w.wg.Wait()
+}
+
+// run executes fn in a new goroutine if a worker is free and in the calling
+// goroutine otherwise, so the walk never blocks on a full pool.
+func (w *unmanagedFilesWalker) run(fn func()) {
+	select {
+	case w.workers <- struct{}{}:
+		w.wg.Add(1)
+		go func() {
+			defer func() {
+				<-w.workers
+				w.wg.Done()
+			}()
+			fn()
+		}()
+	default:
+		fn()
+	}
+}
+
+func (w *unmanagedFilesWalker) found(name string, fileType string, stats *dirStats) {
+	if w.Found != nil {
+		w.Found(name, fileType, stats)
+		return
+	}
+
+	w.mutex.Lock()
+	w.UnmanagedFiles[name] = fileType
+	if stats != nil {
+		w.DirStats[name] = stats
+	}
+	w.mutex.Unlock()
+}
+
+func (w *unmanagedFilesWalker) findUnmanagedFiles(dir string) {
+	if w.tracksDirs() {
+		state, unchanged := w.checkDir(dir, false)
+		w.recordDir(dir, state)
+		if unchanged {
+			w.revisit(dir)
+			return
+		}
+	}
+
+	files, _ := readDir(dir)
+	for _, f := range files {
+		w.visit(dir+f.Name(), f)
+	}
+}
+
+// visit reports the file if it is unmanaged and walks it if it is a managed
+// directory
+func (w *unmanagedFilesWalker) visit(fileName string, f os.FileInfo) {
+	if !utf8.ValidString(fileName) {
+		fmt.Fprintln(os.Stderr, fileName, "contains invalid UTF-8 characters. Skipping.")
+		return
+	}
+	if w.ignores(fileName, f.IsDir()) || w.skipsSubvolume(fileName, f) || w.leavesFileSystem(fileName, f) {
+		return
+	}
+
+	if f.IsDir() {
+		if w.IncludeManaged {
+			w.found(fileName+"/", "dir", nil)
+			w.run(func() { w.findUnmanagedFiles(fileName + "/") })
+		} else if _, ok := w.ManagedDirs[fileName]; ok {
+			w.run(func() { w.findUnmanagedFiles(fileName + "/") })
+		} else if !hasManagedDirs(fileName, w.ManagedDirs) {
+			if w.WithDirStats {
+				w.run(func() { w.findUnmanagedDir(fileName + "/") })
+			} else {
+				w.found(fileName+"/", "dir", nil)
+			}
+		}
+	} else if _, ok := w.ManagedFiles[fileName]; !ok || w.IncludeManaged {
+		if f.Mode()&
+			(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0 {
+			// Ignore sockets, named pipes and devices
+		} else if f.Mode()&os.ModeSymlink == os.ModeSymlink {
+			w.found(fileName, "link", nil)
+		} else {
+			w.found(fileName, "file", nil)
+		}
+	}
+}
+
+// findUnmanagedDir reports an unmanaged directory once the stats of its whole
+// tree are collected
+func (w *unmanagedFilesWalker) findUnmanagedDir(dir string) {
+	stats := &dirStats{}
+	var pending sync.WaitGroup
+	pending.Add(1)
+	w.collectDirStats(dir, stats, &pending)
+	pending.Wait()
+
+	w.found(dir, "dir", stats)
+}
+
+// leavesFileSystem returns whether dir is on a file system which is not in
+// Devices. Nested btrfs subvolumes have a device of their own but belong to
+// the file system of their parent.
+func (w *unmanagedFilesWalker) leavesFileSystem(dir string, f os.FileInfo) bool {
+	if w.Devices == nil || !f.IsDir() {
+		return false
+	}
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok || w.Devices[uint64(stat.Dev)] {
+		return false
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return !w.subvolumes[dir]
+}
+
+// ignores returns whether the path is excluded from the walk
+func (w *unmanagedFilesWalker) ignores(path string, isDir bool) bool {
+	if _, ok := w.IgnoreList[path]; ok {
+		return true
+	}
+	return w.IgnoreRules.ignores(path, isDir)
+}
+
+// collectDirStats adds the size and the number of files and directories of
+// the tree below path to stats. pending is done when the directories which
+// are walked by other workers are finished as well.
+func (w *unmanagedFilesWalker) collectDirStats(path string, stats *dirStats, pending *sync.WaitGroup) {
+	defer pending.Done()
+
+	var state dirState
+	if w.tracksDirs() {
+		var unchanged bool
+		state, unchanged = w.checkDir(path, true)
+		if unchanged {
+			atomic.AddInt64(&stats.Size, state.Size)
+			atomic.AddInt64(&stats.Files, state.Files)
+			atomic.AddInt64(&stats.Dirs, state.Dirs)
+			for _, subDir := range w.Baseline.subdirs[path] {
+				subDir := subDir
+				pending.Add(1)
+				w.run(func() { w.collectDirStats(subDir, stats, pending) })
+			}
+			w.recordDir(path, state)
+			return
+		}
+	}
+
+	files, _ := readDir(path)
+
+	size := int64(0)
+	fileCount := int64(len(files))
+	dirCount := int64(0)
+	for _, f := range files {
+		if w.IgnoreRules.ignores(path+f.Name(), f.IsDir()) {
+			fileCount--
+		} else if f.IsDir() {
+			dirCount++
+			fileCount--
+			subDir := path + f.Name()
+			if !w.ignores(subDir, true) && !w.skipsSubvolume(subDir, f) && !w.leavesFileSystem(subDir, f) {
+				pending.Add(1)
+				w.run(func() { w.collectDirStats(subDir+"/", stats, pending) })
+			}
+		} else if f.Mode()&os.ModeSymlink != os.ModeSymlink && !stats.countedBefore(f) {
+			size += f.Size()
+		}
+	}
+
+	atomic.AddInt64(&stats.Size, size)
+	atomic.AddInt64(&stats.Files, fileCount)
+	atomic.AddInt64(&stats.Dirs, dirCount)
+	state.Size, state.Files, state.Dirs = size, fileCount, dirCount
+	w.recordDir(path, state)
+}
+
+// dirInfo returns the size and the number of files and directories of the
+// tree below path.
+func dirInfo(path string) (size int64, fileCount int, dirCount int) {
+	w := newUnmanagedFilesWalker(nil, nil, IgnoreList, 1)
+	w.IgnoreRules = IgnoreRules
+	stats := &dirStats{}
+	var pending sync.WaitGroup
+	pending.Add(1)
+	w.collectDirStats(path, stats, &pending)
+	pending.Wait()
+
+	return stats.Size, int(stats.Files), int(stats.Dirs)
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/nowk/go-fakefileinfo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUnmanagedFilesWalker(t *testing.T) {
+	/*
+	  We mock the readDir method and return following directory structure:
+	   /usr/                     managed
+	   /usr/lib/                 managed
+	   /usr/lib/libfoo.so        managed
+	   /usr/lib/unmanaged.so
+	   /usr/lib/link -> ...
+	   /usr/lib/dir-NN/          unmanaged, with 3 files and a sub directory
+	   /usr/lib/dir-NN/sub/      with 2 files
+	   /srv/                     unmanaged
+	   /srv/ignored/             ignored
+	*/
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		var files []os.FileInfo
+		switch {
+		case dir == "/":
+			files = append(files, fakefileinfo.New("usr", int64(4096), os.ModeDir, time.Now(), true, nil))
+			files = append(files, fakefileinfo.New("srv", int64(4096), os.ModeDir, time.Now(), true, nil))
+		case dir == "/usr/":
+			files = append(files, fakefileinfo.New("lib", int64(4096), os.ModeDir, time.Now(), true, nil))
+		case dir == "/usr/lib/":
+			files = append(files, fakefileinfo.New("libfoo.so", int64(10), 0, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("unmanaged.so", int64(10), 0, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("link", int64(10), os.ModeSymlink, time.Now(), false, nil))
+			for i := 0; i < 20; i++ {
+				files = append(files, fakefileinfo.New(fmt.Sprintf("dir-%02d", i), int64(4096), os.ModeDir, time.Now(), true, nil))
+			}
+		case dir == "/srv/":
+			files = append(files, fakefileinfo.New("ignored", int64(4096), os.ModeDir, time.Now(), true, nil))
+		case dir == "/srv/ignored/":
+			t.Errorf("ignored directory %v should not be walked", dir)
+		case len(dir) > len("/usr/lib/dir-00/"):
+			files = append(files, fakefileinfo.New("a", int64(1), 0, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("b", int64(2), 0, time.Now(), false, nil))
+		default:
+			files = append(files, fakefileinfo.New("a", int64(1), 0, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("b", int64(2), 0, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("c", int64(3), os.ModeSymlink, time.Now(), false, nil))
+			files = append(files, fakefileinfo.New("sub", int64(4096), os.ModeDir, time.Now(), true, nil))
+		}
+		return files, nil
+	}
+
+	managedFiles := map[string]string{"/usr/lib/libfoo.so": ""}
+	managedDirs := map[string]bool{"/usr": false, "/usr/lib": true}
+	ignoreList := map[string]bool{"/srv/ignored": true}
+
+	wantUnmanagedFiles := map[string]string{
+		"/usr/lib/unmanaged.so": "file",
+		"/usr/lib/link":         "link",
+		"/srv/":                 "dir",
+	}
+	for i := 0; i < 20; i++ {
+		wantUnmanagedFiles[fmt.Sprintf("/usr/lib/dir-%02d/", i)] = "dir"
+	}
+
+	for _, jobs := range []int{1, 4} {
+		walker := newUnmanagedFilesWalker(managedFiles, managedDirs, ignoreList, jobs)
+		walker.WithDirStats = true
+		walker.Walk("/")
+
+		if !reflect.DeepEqual(walker.UnmanagedFiles, wantUnmanagedFiles) {
+			t.Errorf("Walk() with %d jobs = '%v', want '%v'", jobs, walker.UnmanagedFiles, wantUnmanagedFiles)
+		}
+
+		wantStats := map[string][3]int64{
+			"/usr/lib/dir-07/": {6, 5, 1},
+			"/srv/":            {0, 0, 1},
+		}
+		for dir, want := range wantStats {
+			stats := walker.DirStats[dir]
+			if stats == nil || [3]int64{stats.Size, stats.Files, stats.Dirs} != want {
+				t.Errorf("DirStats['%v'] with %d jobs = '%v', want '%v'", dir, jobs, stats, want)
+			}
+		}
+	}
+}
+
+func TestDirStatsHardlinks(t *testing.T) {
+	readDir = ioutil.ReadDir
+	IgnoreList = map[string]bool{}
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "foo"), make([]byte, 100), 0644)
+	os.Link(filepath.Join(dir, "foo"), filepath.Join(dir, "bar"))
+	os.Link(filepath.Join(dir, "foo"), filepath.Join(dir, "sub", "baz"))
+
+	size, files, dirs := dirInfo(dir + "/")
+	if size != 100 || files != 3 || dirs != 1 {
+		t.Errorf("dirInfo() = %d, %d, %d, want 100, 3, 1", size, files, dirs)
+	}
+}
+
+func TestDirInfoIgnoreRules(t *testing.T) {
+	readDir = ioutil.ReadDir
+	IgnoreList = map[string]bool{}
+	IgnoreRules, _ = newIgnoreRules([]string{"*.pyc", "cache/", "!keep.pyc"})
+	defer func() { IgnoreRules = nil }()
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "cache", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "foo.py"), make([]byte, 10), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "foo.pyc"), make([]byte, 100), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "keep.pyc"), make([]byte, 1), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "cache", "bar"), make([]byte, 1000), 0644)
+
+	size, files, dirs := dirInfo(dir + "/")
+	if size != 11 || files != 2 || dirs != 0 {
+		t.Errorf("dirInfo() = %d, %d, %d, want 11, 2, 0", size, files, dirs)
+	}
+}
+
+func TestDirInfoIgnoredSubdirectory(t *testing.T) {
+	readDir = ioutil.ReadDir
+	IgnoreList = map[string]bool{}
+	IgnoreRules, _ = newIgnoreRules([]string{"cache/"})
+	defer func() { IgnoreRules = nil }()
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "lib", "cache", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "lib", "foo"), make([]byte, 10), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "lib", "cache", "bar"), make([]byte, 100), 0644)
+
+	_, files, dirs := dirInfo(dir + "/")
+	if files != 1 {
+		t.Errorf("dirInfo() files = %d, want 1", files)
+	}
+	if dirs != 1 {
+		t.Errorf("dirInfo() dirs = %d, want 1", dirs)
+	}
+}
+
+func TestWalkRoot(t *testing.T) {
+	readDir = ioutil.ReadDir
+
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, subDir := range []string{"etc", "srv/www", "usr/lib", "usr/local", "ignored/sub"} {
+		os.MkdirAll(filepath.Join(dir, subDir), 0755)
+	}
+	for _, file := range []string{"etc/foo", "etc/managed.conf", "srv/www/index.html", "usr/lib/libfoo.so"} {
+		ioutil.WriteFile(filepath.Join(dir, file), []byte{}, 0644)
+	}
+
+	managedFiles := map[string]string{dir + "/etc/managed.conf": ""}
+	managedDirs := map[string]bool{dir + "/etc": true, dir + "/usr/lib": true}
+	ignoreList := map[string]bool{dir + "/ignored": true}
+
+	walker := newUnmanagedFilesWalker(managedFiles, managedDirs, ignoreList, 2)
+	for _, root := range []string{"/etc/", "/srv", "/usr", "/etc/managed.conf", "/ignored/sub", "/missing"} {
+		walker.WalkRoot(dir + root)
+	}
+
+	want := map[string]string{
+		dir + "/etc/foo":           "file",
+		dir + "/srv/":              "dir",
+		dir + "/usr/lib/libfoo.so": "file",
+		dir + "/usr/local/":        "dir",
+	}
+	if !reflect.DeepEqual(walker.UnmanagedFiles, want) {
+		t.Errorf("WalkRoot() = '%v', want '%v'", walker.UnmanagedFiles, want)
+	}
+}
+
+func TestUnmanagedFilesWalkerOneFileSystem(t *testing.T) {
+	/*
+	  We mock the readDir method and return following directory structure:
+	   /usr/                     managed, device 1
+	   /usr/foo
+	   /mnt/                     managed, device 1
+	   /mnt/squashfs/            managed, device 2
+	   /mnt/data/                managed, device 3
+	   /mnt/data/bar
+	   /srv/                     unmanaged, device 1
+	   /srv/fuse/                device 4
+	*/
+	onDevice := func(dev uint64) *syscall.Stat_t {
+		return &syscall.Stat_t{Dev: dev}
+	}
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		var files []os.FileInfo
+		switch dir {
+		case "/":
+			files = append(files, fakefileinfo.New("usr", int64(4096), os.ModeDir, time.Now(), true, onDevice(1)))
+			files = append(files, fakefileinfo.New("mnt", int64(4096), os.ModeDir, time.Now(), true, onDevice(1)))
+			files = append(files, fakefileinfo.New("srv", int64(4096), os.ModeDir, time.Now(), true, onDevice(1)))
+		case "/usr/":
+			files = append(files, fakefileinfo.New("foo", int64(10), 0, time.Now(), false, onDevice(1)))
+		case "/mnt/":
+			files = append(files, fakefileinfo.New("squashfs", int64(4096), os.ModeDir, time.Now(), true, onDevice(2)))
+			files = append(files, fakefileinfo.New("data", int64(4096), os.ModeDir, time.Now(), true, onDevice(3)))
+		case "/mnt/data/":
+			files = append(files, fakefileinfo.New("bar", int64(10), 0, time.Now(), false, onDevice(3)))
+		case "/srv/":
+			files = append(files, fakefileinfo.New("fuse", int64(4096), os.ModeDir, time.Now(), true, onDevice(4)))
+		default:
+			t.Errorf("directory %v should not be walked", dir)
+		}
+		return files, nil
+	}
+
+	managedDirs := map[string]bool{"/usr": true, "/mnt": true, "/mnt/squashfs": true, "/mnt/data": true}
+	walker := newUnmanagedFilesWalker(map[string]string{}, managedDirs, map[string]bool{}, 2)
+	walker.WithDirStats = true
+	walker.Devices = map[uint64]bool{1: true, 3: true}
+	walker.Walk("/")
+
+	want := map[string]string{
+		"/usr/foo":      "file",
+		"/mnt/data/bar": "file",
+		"/srv/":         "dir",
+	}
+	if !reflect.DeepEqual(walker.UnmanagedFiles, want) {
+		t.Errorf("Walk() = '%v', want '%v'", walker.UnmanagedFiles, want)
+	}
+	if stats := walker.DirStats["/srv/"]; stats == nil || stats.Dirs != 1 {
+		t.Errorf("DirStats['/srv/'] = '%v', want the mount counted but not walked", stats)
+	}
+}
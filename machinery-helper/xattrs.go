@@ -0,0 +1,145 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// extended attributes which make up the security context of a file, names
+// ending with a "." match the whole namespace
+var recordedXattrs = []string{
+	"security.selinux",
+	"security.capability",
+	"system.posix_acl_access",
+	"system.posix_acl_default",
+	"user.",
+}
+
+func isRecordedXattr(name string) bool {
+	for _, recorded := range recordedXattrs {
+		if name == recorded || strings.HasSuffix(recorded, ".") && strings.HasPrefix(name, recorded) {
+			return true
+		}
+	}
+	return false
+}
+
+// llistxattr and lgetxattr don't follow symlinks, unlike syscall.Listxattr
+// and syscall.Getxattr
+func llistxattr(path string, dest []byte) (int, error) {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var destPtr unsafe.Pointer
+	if len(dest) > 0 {
+		destPtr = unsafe.Pointer(&dest[0])
+	}
+	size, _, errno := syscall.Syscall(syscall.SYS_LLISTXATTR,
+		uintptr(unsafe.Pointer(pathPtr)), uintptr(destPtr), uintptr(len(dest)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
+}
+
+func lgetxattr(path string, name string, dest []byte) (int, error) {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	namePtr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	var destPtr unsafe.Pointer
+	if len(dest) > 0 {
+		destPtr = unsafe.Pointer(&dest[0])
+	}
+	size, _, errno := syscall.Syscall6(syscall.SYS_LGETXATTR,
+		uintptr(unsafe.Pointer(pathPtr)), uintptr(unsafe.Pointer(namePtr)),
+		uintptr(destPtr), uintptr(len(dest)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
+}
+
+// readXattrBuffer calls read with a buffer which is large enough for the
+// value. The size is queried first and the call is repeated if the value grew
+// in between.
+func readXattrBuffer(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buffer := make([]byte, size)
+		size, err = read(buffer)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buffer[:size], nil
+	}
+}
+
+// readXattrs returns the recorded extended attributes of a file without
+// following symlinks. File systems without extended attributes have none.
+func readXattrs(path string) (map[string][]byte, error) {
+	list, err := readXattrBuffer(func(dest []byte) (int, error) {
+		return llistxattr(path, dest)
+	})
+	if err == syscall.ENOTSUP {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var xattrs map[string][]byte
+	for _, name := range bytes.Split(list, []byte{0}) {
+		if len(name) == 0 || !isRecordedXattr(string(name)) {
+			continue
+		}
+		value, err := readXattrBuffer(func(dest []byte) (int, error) {
+			return lgetxattr(path, string(name), dest)
+		})
+		if err == syscall.ENODATA {
+			// removed after it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		if value == nil {
+			value = []byte{}
+		}
+		xattrs[string(name)] = value
+	}
+	return xattrs, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or
+// modify it under the terms of version 3 of the GNU General Public License as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, contact SUSE LLC.
+//
+// To contact SUSE about this file by physical or electronic mail,
+// you may find current contact information at www.suse.com
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsRecordedXattr(t *testing.T) {
+	expected := map[string]bool{
+		"security.selinux":        true,
+		"security.capability":     true,
+		"system.posix_acl_access": true,
+		"user.mime_type":          true,
+		"security.ima":            false,
+		"trusted.overlay.opaque":  false,
+		"user":                    false,
+	}
+	for name, want := range expected {
+		if actual := isRecordedXattr(name); actual != want {
+			t.Errorf("isRecordedXattr('%v') = '%v', want '%v'", name, actual, want)
+		}
+	}
+}
+
+// createXattrTestFile creates a file with the user.machinery attribute and
+// skips the test if the file system does not support user attributes
+func createXattrTestFile(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := syscall.Setxattr(path, "user.machinery", []byte("helper"), 0)
+	if err == syscall.ENOTSUP || err == syscall.EPERM {
+		t.Skip("the file system does not support user extended attributes")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Setxattr(path, "trusted.machinery", []byte("ignored"), 0)
+	return path
+}
+
+func TestReadXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := createXattrTestFile(t, dir)
+	os.Symlink(path, filepath.Join(dir, "link"))
+
+	xattrs, err := readXattrs(path)
+	if err != nil {
+		t.Fatalf("readXattrs() failed: %v", err)
+	}
+	if len(xattrs) != 1 || string(xattrs["user.machinery"]) != "helper" {
+		t.Errorf("readXattrs() = '%v', want only user.machinery", xattrs)
+	}
+
+	xattrs, err = readXattrs(filepath.Join(dir, "link"))
+	if err != nil || xattrs["user.machinery"] != nil {
+		t.Errorf("readXattrs() should not follow links, got '%v', '%v'", xattrs, err)
+	}
+}
+
+func TestAddPathXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinery-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := createXattrTestFile(t, dir)
+	var archive bytes.Buffer
+	defer func(original *tar.Writer) { tarWriter = original }(tarWriter)
+	tarWriter = tar.NewWriter(&archive)
+
+	fi, _ := os.Lstat(path)
+	if err := addPath(path, fi, nil); err != nil {
+		t.Fatalf("addPath() failed: %v", err)
+	}
+	tarWriter.Close()
+
+	header, err := tar.NewReader(&archive).Next()
+	if err != nil {
+		t.Fatalf("reading the archive failed: %v", err)
+	}
+	if value := header.Xattrs["user.machinery"]; value != "helper" {
+		t.Errorf("header.Xattrs['user.machinery'] = '%v', want 'helper'", value)
+	}
+}
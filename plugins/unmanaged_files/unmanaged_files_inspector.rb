@@ -21,7 +21,7 @@ module Machinery
 
     # checks if all required binaries are present
     def check_requirements(check_tar)
-      @system.check_requirement(["rpm", "dpkg"], "--version")
+      @system.check_requirement(["rpm", "dpkg", "apk", "pacman"], "--version")
       @system.check_create_archive_dependencies if check_tar
     end
 
@@ -56,6 +56,9 @@ module Machinery
         helper_options = {}
         helper_options[:do_extract] = do_extract
         helper_options[:extract_metadata] = options[:extract_metadata]
+        helper_options[:paths] = options[:unmanaged_files_paths]
+        helper_options[:baseline] = options[:unmanaged_files_baseline]
+        helper_options[:previous] = @description["unmanaged_files"]
 
         run_helper_inspection(helper, file_filter, file_store_tmp, file_store_final,
           scope, helper_options)
@@ -83,8 +86,14 @@ module Machinery
 
         args = []
         args.push("--extract-metadata") if options[:extract_metadata] || options[:do_extract]
+        args.push(*helper_excludes(filter))
+        args.push(*Array(options[:paths]).map { |path| "--root=#{path}" })
+        args.push(*helper_baseline(options))
 
-        helper.run_helper(scope, *args)
+        previous = options[:previous] if options[:baseline]
+        helper.run_helper(scope, *args, previous: previous) do |count|
+          show_inspection_progress(count)
+        end
         scope.delete_if { |f| filter.matches?(f.name) }
 
         if options[:do_extract]
@@ -131,6 +140,35 @@ module Machinery
 
     private
 
+    # The filtered trees are excluded in the helper already, so they are not
+    # walked at all. Only plain paths and trailing wildcards mean the same as
+    # a glob there, the scope is still filtered afterwards for the rest.
+    def helper_excludes(filter)
+      Array(filter.matchers[Machinery::Filter::OPERATOR_EQUALS]).select do |matcher|
+        matcher.is_a?(String) && matcher !~ /[?\[\\]|\*./
+      end.map { |matcher| "--exclude=#{matcher}" }
+    end
+
+    # The baseline is kept on the inspected system. The helper only reports the
+    # changes since then if the previous inspection saved the same baseline, so
+    # the changes are applied to the files they belong to.
+    def helper_baseline(options)
+      return [] unless options[:baseline]
+
+      args = ["--save-baseline=#{options[:baseline]}"]
+      id = options[:previous] && options[:previous].baseline
+      args.push("--baseline=#{options[:baseline]}", "--baseline-id=#{id}") if id
+      args
+    end
+
+    def show_inspection_progress(count)
+      progress = Machinery.pluralize(
+        count, " -> Found %d unmanaged file or tree...",
+          " -> Found %d unmanaged files and/or trees..."
+      )
+      Machinery::Ui.progress(progress)
+    end
+
     def show_extraction_progress(count)
       progress = Machinery.pluralize(
         count, " -> Extracted %d unmanaged file or tree...",
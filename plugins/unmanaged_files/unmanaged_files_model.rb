@@ -26,7 +26,13 @@ module Machinery
     include Machinery::Scope
     include Machinery::ScopeFileAccessArchive
 
-    has_attributes :extracted, :has_metadata
+    # These attributes identify the inode on the inspected system, so they differ
+    # between systems even for identical files and are not compared.
+    INODE_ATTRIBUTES = ["mtime", "ctime", "inode", "nlink", "dev"]
+
+    # The baseline attribute identifies the baseline of the inspection on the
+    # inspected system, it is not compared either.
+    has_attributes :extracted, :has_metadata, :baseline
     has_elements class: UnmanagedFile
 
     def compare_with(other)
@@ -58,11 +64,13 @@ module Machinery
       end
       changed = Machinery::Scope.extract_changed_elements(only_self, only_other, :name)
 
-      if attributes == other.attributes
-        common_attributes = attributes
+      self_attributes = attributes.reject { |key, _| key == "baseline" }
+      other_attributes = other.attributes.reject { |key, _| key == "baseline" }
+      if self_attributes == other_attributes
+        common_attributes = self_attributes
       else
-        only_self_attributes = attributes
-        only_other_attributes = other.attributes
+        only_self_attributes = self_attributes
+        only_other_attributes = other_attributes
       end
 
       comparison = [
@@ -91,7 +99,7 @@ module Machinery
     private
 
     def files_match(a, b)
-      common_attributes = a.attributes.keys & b.attributes.keys
+      common_attributes = (a.attributes.keys & b.attributes.keys) - INODE_ATTRIBUTES
       common_attributes.all? do |attribute|
         a[attribute] == b[attribute]
       end
@@ -0,0 +1,27 @@
+# Copyright (c) 2013-2016 SUSE LLC
+#
+# This program is free software; you can redistribute it and/or
+# modify it under the terms of version 3 of the GNU General Public License as
+# published by the Free Software Foundation.
+#
+# This program is distributed in the hope that it will be useful,
+# but WITHOUT ANY WARRANTY; without even the implied warranty of
+# MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+# GNU General Public License for more details.
+#
+# You should have received a copy of the GNU General Public License
+# along with this program; if not, contact SUSE LLC.
+#
+# To contact SUSE about this file by physical or electronic mail,
+# you may find current contact information at www.suse.com
+
+class Machinery::Migrate10To11 < Machinery::Migration
+  desc <<-EOT
+    Add the modification and change times as well as the inode number, link count and device
+    id to the meta data of unmanaged files. The information is not available for migrated
+    descriptions, so the existing entries are kept as they are.
+  EOT
+
+  def migrate
+  end
+end
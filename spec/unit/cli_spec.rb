@@ -95,6 +95,12 @@ describe Machinery::Cli do
 
       run_command(["inspect-container", "docker/foo", "--name=docker_foo"])
     end
+
+    it "does not accept the --unmanaged-files-baseline option" do
+      expect_any_instance_of(Machinery::InspectTask).not_to receive(:inspect_system)
+      run_command(["inspect-container", "--unmanaged-files-baseline=/baseline.json",
+        "docker_image_foo"])
+    end
   end
 
   describe ".check_container_name!" do
@@ -482,6 +488,39 @@ describe Machinery::Cli do
           run_command(["inspect", "--extract-unmanaged-files", example_host])
         end
       end
+
+      it "forwards the --unmanaged-files-path option to the InspectTask" do
+        expect_any_instance_of(Machinery::InspectTask).to receive(:inspect_system).
+          with(
+            an_instance_of(Machinery::SystemDescriptionStore),
+            an_instance_of(Machinery::RemoteSystem),
+            example_host,
+            an_instance_of(Machinery::CurrentUser),
+            Machinery::Inspector.all_scopes,
+            an_instance_of(Machinery::Filter),
+            unmanaged_files_paths: ["/etc", "/srv"]
+          ).
+          and_return(description)
+
+        run_command(["inspect", "--unmanaged-files-path=/etc,/srv", example_host])
+      end
+
+      it "forwards the --unmanaged-files-baseline option to the InspectTask" do
+        expect_any_instance_of(Machinery::InspectTask).to receive(:inspect_system).
+          with(
+            an_instance_of(Machinery::SystemDescriptionStore),
+            an_instance_of(Machinery::RemoteSystem),
+            example_host,
+            an_instance_of(Machinery::CurrentUser),
+            Machinery::Inspector.all_scopes,
+            an_instance_of(Machinery::Filter),
+            unmanaged_files_baseline: "/var/lib/machinery/baseline.json"
+          ).
+          and_return(description)
+
+        run_command(["inspect", "--unmanaged-files-baseline=/var/lib/machinery/baseline.json",
+          example_host])
+      end
     end
 
     describe "#build" do
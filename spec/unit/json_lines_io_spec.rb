@@ -0,0 +1,43 @@
+# Copyright (c) 2016 SUSE LLC
+#
+# This program is free software; you can redistribute it and/or
+# modify it under the terms of version 3 of the GNU General Public License as
+# published by the Free Software Foundation.
+#
+# This program is distributed in the hope that it will be useful,
+# but WITHOUT ANY WARRANTY; without even the implied warranty of
+# MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+# GNU General Public License for more details.
+#
+# You should have received a copy of the GNU General Public License
+# along with this program; if not, contact SUSE LLC.
+#
+# To contact SUSE about this file by physical or electronic mail,
+# you may find current contact information at www.suse.com
+
+require_relative "spec_helper"
+
+describe JsonLinesIO do
+  let(:records) { [] }
+  subject { JsonLinesIO.new { |record| records << record } }
+
+  describe "#write" do
+    it "passes each parsed line to the block" do
+      subject.write("{\"name\":\"/foo\"}\n{\"name\":\"/bar\"}\n")
+      expect(records).to eq([{ "name" => "/foo" }, { "name" => "/bar" }])
+    end
+
+    it "waits for lines which are split across writes" do
+      subject.write("{\"name\":")
+      expect(records).to be_empty
+
+      subject << "\"/foo\"}\n"
+      expect(records).to eq([{ "name" => "/foo" }])
+    end
+
+    it "ignores empty lines" do
+      subject.write("\n{\"name\":\"/foo\"}\n\n")
+      expect(records).to eq([{ "name" => "/foo" }])
+    end
+  end
+end
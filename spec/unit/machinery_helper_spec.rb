@@ -95,33 +95,22 @@ describe MachineryHelper do
 
   describe "#run_helper" do
     let(:scope) { Machinery::UnmanagedFilesScope.new }
-    let(:json) { <<-EOT
-        {
-          "files": [
-            {
-              "name": "/opt/magic/file",
-              "type": "file",
-              "user": "root",
-              "group": "root",
-              "size": 0,
-              "mode": "644"
-            },
-            {
-              "name": "/opt/magic/other_file",
-              "type": "file",
-              "user": "root",
-              "group": "root",
-              "size": 0,
-              "mode": "644"
-            }
-          ]
-        }
+    let(:ndjson) { <<-EOT
+{"name":"/opt/magic/other_file","type":"file","user":"root","group":"root","size":0,"mode":"644"}
+{"name":"/opt/magic/file","type":"file","user":"root","group":"root","size":0,"mode":"644"}
+{"trailer":true,"extracted":false,"total":2,"types":{"file":2},"size":0}
       EOT
     }
 
+    def helper_output(output)
+      lambda do |*_args, options|
+        output.each_line { |line| options[:stdout].write(line) }
+      end
+    end
+
     it "writes the inspection result into the scope" do
-      expect(dummy_system).to receive(:run_command).with("/root/machinery-helper", any_args).
-        and_return(json)
+      expect(dummy_system).to receive(:run_command).
+        with("/root/machinery-helper", "--format=ndjson", any_args, &helper_output(ndjson))
 
       subject.run_helper(scope)
 
@@ -129,13 +118,58 @@ describe MachineryHelper do
       expect(scope.count).to eq(2)
     end
 
+    it "yields the number of files found so far" do
+      expect(dummy_system).to receive(:run_command).
+        with("/root/machinery-helper", any_args, &helper_output(ndjson))
+
+      counts = []
+      subject.run_helper(scope) { |count| counts << count }
+
+      expect(counts).to eq([1, 2])
+    end
+
     it "pases the extract metadata option" do
       expect(dummy_system).to receive(:run_command).
-        with("/root/machinery-helper", "--extract-metadata", any_args).and_return(json)
+        with("/root/machinery-helper", "--format=ndjson", "--extract-metadata", any_args,
+          &helper_output(ndjson))
 
       subject.run_helper(scope, "--extract-metadata")
     end
 
+    it "applies the changes since the baseline to the previous files" do
+      delta = <<-EOT
+{"name":"/opt/magic/file","type":"file","user":"root","group":"root","size":5,"mode":"644","change":"modified"}
+{"name":"/opt/magic/new_file","type":"file","user":"root","group":"root","size":0,"mode":"644","change":"added"}
+{"name":"/opt/magic/other_file","type":"file","change":"removed"}
+{"trailer":true,"extracted":false,"total":3,"types":{"file":3},"size":5,"delta":true,"baseline":42}
+      EOT
+      previous = Machinery::UnmanagedFilesScope.new(
+        [
+          { name: "/etc/unchanged", type: "file", user: "root", group: "root", size: 1, mode: "644" },
+          { name: "/opt/magic/file", type: "file", user: "root", group: "root", size: 0, mode: "644" },
+          { name: "/opt/magic/other_file", type: "file", user: "root", group: "root", size: 0, mode: "644" }
+        ]
+      )
+      expect(dummy_system).to receive(:run_command).
+        with("/root/machinery-helper", any_args, &helper_output(delta))
+
+      subject.run_helper(scope, "--baseline=/baseline.json", "--baseline-id=23", previous: previous)
+
+      expect(scope.map(&:name)).to eq(["/etc/unchanged", "/opt/magic/file", "/opt/magic/new_file"])
+      expect(scope.find { |file| file.name == "/opt/magic/file" }.size).to eq(5)
+      expect(scope.map { |file| file["change"] }.compact).to be_empty
+      expect(scope.baseline).to eq(42)
+    end
+
+    it "raises when the output is incomplete" do
+      expect(dummy_system).to receive(:run_command).
+        with("/root/machinery-helper", any_args, &helper_output(ndjson.lines.first))
+
+      expect { subject.run_helper(scope) }.to raise_error(
+        Machinery::Errors::MachineryError, /incomplete/
+      )
+    end
+
     context "when errors occur" do
       before(:each) do
         expect(dummy_system).to receive(:run_command).with("/root/machinery-helper", any_args).
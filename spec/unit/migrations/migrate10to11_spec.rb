@@ -0,0 +1,64 @@
+# Copyright (c) 2013-2014 SUSE LLC
+#
+# This program is free software; you can redistribute it and/or
+# modify it under the terms of version 3 of the GNU General Public License as
+# published by the Free Software Foundation.
+#
+# This program is distributed in the hope that it will be useful,
+# but WITHOUT ANY WARRANTY; without even the implied warranty of
+# MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.   See the
+# GNU General Public License for more details.
+#
+# You should have received a copy of the GNU General Public License
+# along with this program; if not, contact SUSE LLC.
+#
+# To contact SUSE about this file by physical or electronic mail,
+# you may find current contact information at www.suse.com
+
+require_relative "../spec_helper"
+require File.join(Machinery::ROOT, "schema/migrations/migrate10to11")
+
+describe Machinery::Migrate10To11 do
+  initialize_system_description_factory_store
+
+  let(:description_hash) {
+    JSON.parse(<<-EOT)
+      {
+        "unmanaged_files": {
+          "_attributes": {
+            "extracted": false,
+            "has_metadata": true
+          },
+          "_elements": [
+            {
+              "name": "/etc/tarball with spaces/",
+              "type": "dir",
+              "user": "root",
+              "group": "root",
+              "size": 12345,
+              "mode": "755",
+              "files": 16,
+              "dirs": 2
+            }
+          ]
+        },
+        "meta": {
+          "format_version": 10,
+          "unmanaged_files": {
+            "modified": "2014-12-04T14:57:58Z",
+            "hostname": "localhost"
+          }
+        }
+      }
+    EOT
+  }
+  let(:description_base) { system_description_factory_store.description_path("description") }
+
+  it "keeps the unmanaged files as they are" do
+    original = Marshal.load(Marshal.dump(description_hash))
+    migration = Machinery::Migrate10To11.new(description_hash, description_base)
+    migration.migrate
+
+    expect(description_hash).to eq(original)
+  end
+end
@@ -186,6 +186,45 @@ describe "unmanaged_files model" do
         )
       end
 
+      it "does not compare the inode attributes" do
+        scope = Machinery::UnmanagedFilesScope.new(
+          [
+            Machinery::UnmanagedFile.new(
+              name:  "/foo",
+              size:  2,
+              mtime: "2016-03-01T12:30:00Z",
+              inode: 1234,
+              dev:   2049
+            )
+          ]
+        )
+        scope_other_system = Machinery::UnmanagedFilesScope.new(
+          [
+            Machinery::UnmanagedFile.new(
+              name:  "/foo",
+              size:  2,
+              mtime: "2016-04-01T08:00:00Z",
+              inode: 5678,
+              dev:   2050
+            )
+          ]
+        )
+
+        expect(scope.compare_with(scope_other_system)).to eq([nil, nil, nil, scope])
+      end
+
+      it "does not compare the baseline" do
+        files = [Machinery::UnmanagedFile.new(name: "/foo", type: "file")]
+        scope = Machinery::UnmanagedFilesScope.new(files, extracted: false, baseline: 1)
+        scope_other_baseline = Machinery::UnmanagedFilesScope.new(
+          files, extracted: false, baseline: 2
+        )
+
+        expect(scope.compare_with(scope_other_baseline)).to eq(
+          [nil, nil, nil, Machinery::UnmanagedFilesScope.new(files, extracted: false)]
+        )
+      end
+
       it "keeps the common elements if there are common attributes" do
         scope = Machinery::UnmanagedFilesScope.new(
           [
@@ -63,5 +63,77 @@ describe Machinery::UnmanagedFilesInspector do
         )
       end
     end
+
+    it "only inspects the given paths" do
+      expect_any_instance_of(MachineryHelper).to receive(:run_helper) do |_instance, _scope, *args|
+        expect(args).to include("--root=/etc", "--root=/srv")
+      end
+
+      inspector.inspect(
+        Machinery::Filter.from_default_definition("inspect"),
+        unmanaged_files_paths: ["/etc", "/srv"]
+      )
+    end
+
+    context "when a baseline is given" do
+      let(:baseline) { "/var/lib/machinery/baseline.json" }
+
+      it "only saves the baseline without a previous inspection" do
+        expect_any_instance_of(MachineryHelper).to receive(:run_helper) do |_instance, _scope, *args|
+          expect(args).to include("--save-baseline=#{baseline}")
+          expect(args).not_to include("--baseline=#{baseline}")
+        end
+
+        inspector.inspect(
+          Machinery::Filter.from_default_definition("inspect"),
+          unmanaged_files_baseline: baseline
+        )
+      end
+
+      it "applies the changes to the previous inspection" do
+        previous = Machinery::UnmanagedFilesScope.new(
+          [{ name: "/etc/foo", type: "file" }], extracted: false, has_metadata: false, baseline: 42
+        )
+        description["unmanaged_files"] = previous
+        expect_any_instance_of(MachineryHelper).to receive(:run_helper) do |_instance, _scope, *args|
+          expect(args).to include(
+            "--save-baseline=#{baseline}", "--baseline=#{baseline}", "--baseline-id=42"
+          )
+          expect(args.last).to eq(previous: previous)
+        end
+
+        inspector.inspect(
+          Machinery::Filter.from_default_definition("inspect"),
+          unmanaged_files_baseline: baseline
+        )
+      end
+
+      it "does not use the baseline if the previous inspection did not save it" do
+        description["unmanaged_files"] = Machinery::UnmanagedFilesScope.new(
+          [{ name: "/etc/foo", type: "file" }], extracted: false, has_metadata: false
+        )
+        expect_any_instance_of(MachineryHelper).to receive(:run_helper) do |_instance, _scope, *args|
+          expect(args).to include("--save-baseline=#{baseline}")
+          expect(args).not_to include("--baseline=#{baseline}")
+        end
+
+        inspector.inspect(
+          Machinery::Filter.from_default_definition("inspect"),
+          unmanaged_files_baseline: baseline
+        )
+      end
+    end
+
+    it "passes the filtered paths to the helper" do
+      expect_any_instance_of(MachineryHelper).to receive(:run_helper) do |_instance, _scope, *args|
+        expect(args).to include("--exclude=/var/lib/rpm", "--exclude=/var/lib/rpm/*")
+        expect(args).to include("--exclude=#{description.store.base_path}")
+        expect(args).not_to include("--exclude=/foo/*bar")
+      end
+
+      filter = Machinery::Filter.from_default_definition("inspect")
+      filter.add_element_filter_from_definition("/unmanaged_files/name=/foo/*bar")
+      inspector.inspect(filter)
+    end
   end
 end